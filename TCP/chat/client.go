@@ -0,0 +1,86 @@
+package chat
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// >> RunClient chats with the server at address, from a terminal
+// each line read from in is a command, such as ":JOIN, lobby", or else a
+// message to the current room. what the server sends is written to out as
+// it arrives, until in ends. the default port is used if address has none
+func RunClient(address string, in io.Reader, out io.Writer) error {
+	address = withPort(address)
+	u := &user{address: address}
+	if err := u.connect(address); err != nil {
+		return err
+	}
+	defer func() { _ = u.Connection.Close() }()
+
+	// >> both the commands & the messages write to out
+	var mu sync.Mutex
+	printf := func(format string, v ...interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		_, _ = fmt.Fprintf(out, format, v...)
+	}
+	rendered := make(chan struct{})
+	go func() {
+		defer close(rendered)
+		for msg := range u.messages {
+			printf("%s\n", u.render(msg))
+		}
+		printf("disconnected from %s\n", address)
+	}()
+
+	printf("connected to %s, join a room with :JOIN, <room>, or see :HELP\n", address)
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		output, err := u.handleUserInput(line)
+		switch {
+		case err != nil:
+			printf("%v\n", err)
+		case output != "":
+			printf("%s\n", output)
+		}
+	}
+
+	// >> the rest of what the server sent is shown before returning
+	_ = u.Connection.Close()
+	<-rendered
+	return scanner.Err()
+}
+
+// >> formats a message from the server for the terminal
+// such as "[lobby] alice: hello"
+func (u *user) render(msg message) string {
+	from := msg.Name
+	if from == "" {
+		from = msg.UserIP
+	}
+	switch msg.Kind {
+	case kindError:
+		return fmt.Sprintf("error %d: %s", msg.Code, msg.Content)
+	case kindDirect:
+		return fmt.Sprintf("[direct] %s: %s", from, msg.Content)
+	}
+	return fmt.Sprintf("[%s] %s: %s", u.roomTag(msg.RoomID), from, msg.Content)
+}
+
+// >> a room's name if it's known, or else its ID
+func (u *user) roomTag(room int) string {
+	u.namesMu.Lock()
+	defer u.namesMu.Unlock()
+	if name, ok := u.roomNames[room]; ok {
+		return name
+	}
+	return strconv.Itoa(room)
+}
@@ -0,0 +1,89 @@
+package chat
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// >> what a client has written, read while it's still writing
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// >> waits for the client to have written line
+func waitLine(t *testing.T, out *syncBuffer, line string) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		return strings.Contains(out.String(), line+"\n")
+	}, 2*time.Second, 10*time.Millisecond, "waiting for %q in:\n%s", line, out)
+}
+
+func TestRunClient(t *testing.T) {
+	s, address := testServer(t)
+	in, typed := io.Pipe()
+	out := new(syncBuffer)
+	done := make(chan error)
+	go func() { done <- RunClient(address, in, out) }()
+	waitLine(t, out, "connected to "+address+", join a room with :JOIN, <room>, or see :HELP")
+
+	enter := func(line string) {
+		t.Helper()
+		_, err := io.WriteString(typed, line+"\n")
+		require.NoError(t, err)
+	}
+
+	// >> commands go through the command table
+	enter(":NAME, alice")
+	enter(":JOIN, lobby")
+	waitMembers(t, s, 0, 1)
+
+	// >> & messages from the room are shown with their sender & room
+	bob := testUser(t, address)
+	require.NoError(t, bob.setName("bob"))
+	require.NoError(t, bob.join(address, 0))
+	require.NoError(t, bob.sendMessage("hi alice"))
+	waitLine(t, out, "[lobby] bob: hi alice")
+	enter("hi bob")
+	waitLine(t, out, "[lobby] alice: hi bob")
+
+	// >> rooms joined by number are shown by number
+	enter(":SWITCH, 12")
+	waitMembers(t, s, 12, 1)
+	enter("anyone?")
+	waitLine(t, out, "[12] alice: anyone?")
+
+	// >> mistakes are reported, without ending the session
+	enter(":NAME, bob")
+	waitLine(t, out, `error 409: "bob" is taken`)
+	enter(":JUMP, 3")
+	waitLine(t, out, "error: unknown command :JUMP, see :HELP")
+
+	// >> the client stops when its input ends
+	require.NoError(t, typed.Close())
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("client didn't stop")
+	}
+	waitLine(t, out, "disconnected from "+address)
+}
@@ -0,0 +1,201 @@
+package chat
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// >> a command users can type
+// the name follows a colon, and each argument a separator, such as
+// ":MSG, bob, hello". the last argument takes the rest of the line
+type command struct {
+	args  int    // the number of arguments
+	usage string // how the command is typed
+	help  string // what it does
+	run   func(u *user, args []string) (string, error)
+}
+
+// >> the commands, by name
+// a command's output is shown to the user, if not empty
+var commands = map[string]command{
+	"JOIN": {
+		args:  1,
+		usage: ":JOIN, <room>",
+		help:  "joins a room, by number or name. named rooms are created if new",
+		run:   (*user).runJoin,
+	},
+	"SWITCH": {
+		args:  1,
+		usage: ":SWITCH, <room>",
+		help:  "moves to another room",
+		run:   (*user).runJoin,
+	},
+	"LEAVE": {
+		usage: ":LEAVE",
+		help:  "leaves the current room",
+		run:   (*user).runLeave,
+	},
+	"NAME": {
+		args:  1,
+		usage: ":NAME, <name>",
+		help:  "sets the name shown on your messages",
+		run:   func(u *user, args []string) (string, error) { return "", u.setName(args[0]) },
+	},
+	"MSG": {
+		args:  2,
+		usage: ":MSG, <name>, <message>",
+		help:  "sends a message to a single user",
+		run:   (*user).runMsg,
+	},
+	"WHO": {
+		usage: ":WHO",
+		help:  "lists the members of the current room",
+		run:   (*user).runWho,
+	},
+	"RENAME": {
+		args:  2,
+		usage: ":RENAME, <room>, <name>",
+		help:  "gives a room another name",
+		run:   (*user).runRename,
+	},
+	"ROOMS": {
+		usage: ":ROOMS",
+		help:  "lists the rooms in use",
+		run:   (*user).runRooms,
+	},
+}
+
+// >> HELP lists every command, so it can't be in the map's initializer
+func init() {
+	commands["HELP"] = command{
+		usage: ":HELP",
+		help:  "lists the commands",
+		run:   func(*user, []string) (string, error) { return help(), nil },
+	}
+}
+
+func help() string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "%-26s %s\n", commands[name].usage, commands[name].help)
+	}
+	b.WriteString("anything else is said to the current room")
+	return b.String()
+}
+
+// >> Checks if the required argument count is correct
+func checkArgs(cmd command, actual int) error {
+	if cmd.args != actual {
+		return fmt.Errorf("error: expected %d arguments, got %d\nusage: %s", cmd.args, actual, cmd.usage)
+	}
+	return nil
+}
+
+// >> Handles user input
+// returns what to show the user, if anything
+func (u *user) handleUserInput(line string) (string, error) {
+	// >> If command is actually a message
+	if !strings.HasPrefix(line, ":") {
+		return "", u.sendMessage(line)
+	}
+
+	// >> Splitting the command into it's components
+	parts := strings.SplitN(line, separator, 2)
+	name := strings.ToUpper(parts[0][1:])
+	cmd, ok := commands[name]
+	if !ok {
+		return "", fmt.Errorf("error: unknown command %s, see :HELP", parts[0])
+	}
+	var args []string
+	switch {
+	case len(parts) == 1:
+	case cmd.args == 0: // > anything after the command is one too many
+		args = parts[1:]
+	default:
+		args = strings.SplitN(parts[1], separator, cmd.args)
+	}
+	if err := checkArgs(cmd, len(args)); err != nil {
+		return "", err
+	}
+	return cmd.run(u, args)
+}
+
+func (u *user) runJoin(args []string) (string, error) {
+	if err := u.connect(u.address); err != nil {
+		return "", err
+	}
+	room, err := u.getRoomID(args[0])
+	if err != nil {
+		return "", err
+	}
+	return "", u.join(u.address, room)
+}
+
+func (u *user) runLeave([]string) (string, error) {
+	room := u.CurrentRoom
+	if err := u.leave(); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("left %s", u.roomTag(room)), nil
+}
+
+func (u *user) runMsg(args []string) (string, error) {
+	if err := u.sendDirect(args[0], args[1]); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("[direct] to %s: %s", args[0], args[1]), nil
+}
+
+func (u *user) runWho([]string) (string, error) {
+	members, err := u.who()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("in %s: %s", u.roomTag(u.CurrentRoom), strings.Join(members, separator)), nil
+}
+
+func (u *user) runRename(args []string) (string, error) {
+	if err := u.connect(u.address); err != nil {
+		return "", err
+	}
+
+	// >> unlike joining, a name that's not in use is a mistake
+	// not a room to create
+	room, err := strconv.Atoi(args[0])
+	if err != nil {
+		if room, err = u.ResolveRoomName(args[0]); err != nil {
+			return "", err
+		}
+	}
+	if err := u.renameRoom(room, args[1]); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("renamed room %d to %s", room, args[1]), nil
+}
+
+func (u *user) runRooms([]string) (string, error) {
+	rooms, err := u.listRooms()
+	if err != nil {
+		return "", err
+	}
+	if len(rooms) == 0 {
+		return "no rooms in use", nil
+	}
+	lines := make([]string, len(rooms))
+	for i, r := range rooms {
+		lines[i] = fmt.Sprintf("%d", r.ID)
+		if r.Name != "" {
+			lines[i] += " " + r.Name
+		}
+		lines[i] += fmt.Sprintf(" (%d members)", r.Members)
+	}
+	return strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,93 @@
+package chat
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommands(t *testing.T) {
+	s, address := testServer(t)
+	alice, bob := testUser(t, address), testUser(t, address)
+	alice.address, bob.address = address, address
+	run := func(u *user, line string) string {
+		t.Helper()
+		output, err := u.handleUserInput(line)
+		require.NoError(t, err, line)
+		return output
+	}
+	fails := func(u *user, line string, code int) {
+		t.Helper()
+		_, err := u.handleUserInput(line)
+		requireCode(t, code, err)
+	}
+
+	run(alice, ":NAME, alice")
+	run(bob, ":name, bob") // > commands are case insensitive
+	run(alice, ":JOIN, lobby")
+	run(bob, ":JOIN, lobby")
+	waitMembers(t, s, 0, 2)
+
+	// >> the members of the room, & the rooms
+	require.Equal(t, "in lobby: alice, bob", run(alice, ":WHO"))
+	require.Equal(t, "renamed room 5 to quiet", run(bob, ":RENAME, 5, quiet"))
+	require.Equal(t, "0 lobby (2 members)\n5 quiet (0 members)", run(alice, ":ROOMS"))
+
+	// >> renaming a room by name, which its messages are then shown with
+	require.Equal(t, "renamed room 0 to hall", run(alice, ":RENAME, lobby, hall"))
+	require.Equal(t, "in hall: alice, bob", run(alice, ":WHO"))
+	fails(bob, ":RENAME, 5, hall", codeRoomTaken)
+	fails(bob, ":RENAME, 500, attic", codeBadRequest)
+	fails(bob, ":RENAME, typo, attic", codeUnknownRoom) // > & isn't created
+	require.Equal(t, "0 hall (2 members)\n5 quiet (0 members)", run(alice, ":ROOMS"))
+
+	// >> direct messages reach the recipient alone, separators & all
+	require.Equal(t, "[direct] to bob: psst, over here", run(alice, ":MSG, bob, psst, over here"))
+	msg := receive(t, bob)
+	require.Equal(t, kindDirect, msg.Kind)
+	require.Equal(t, "alice", msg.Name)
+	require.Equal(t, "psst, over here", msg.Content)
+	require.Equal(t, "[direct] alice: psst, over here", bob.render(msg))
+	fails(alice, ":MSG, carol, hello", codeUnknownUser)
+
+	// >> leaving the room
+	require.Equal(t, "left lobby", run(bob, ":LEAVE")) // > bob knows it by its old name
+	waitMembers(t, s, 0, 1)
+	fails(bob, ":LEAVE", codeBadRequest)
+	fails(bob, ":WHO", codeBadRequest)
+	require.Equal(t, "in hall: alice", run(alice, ":WHO"))
+
+	// >> mistakes in commands are reported with their usage
+	for line, usage := range map[string]string{
+		":MSG, bob":       ":MSG, <name>, <message>",
+		":JOIN":           ":JOIN, <room>",
+		":RENAME, lobby":  ":RENAME, <room>, <name>",
+		":WHO, everyone?": ":WHO",
+	} {
+		_, err := alice.handleUserInput(line)
+		require.Error(t, err, line)
+		require.True(t, strings.HasSuffix(err.Error(), "usage: "+usage), err.Error())
+	}
+	_, err := alice.handleUserInput(":DANCE")
+	require.EqualError(t, err, "error: unknown command :DANCE, see :HELP")
+
+	// >> every command has its usage in the help
+	help := run(alice, ":HELP")
+	for name, cmd := range commands {
+		require.Contains(t, help, cmd.usage, name)
+	}
+}
+
+// >> the next message the server sent the user, other than replies
+func receive(t *testing.T, u *user) message {
+	t.Helper()
+	select {
+	case msg := <-u.messages:
+		return msg
+	case <-time.After(2 * time.Second):
+		t.Fatal("no message")
+		return message{}
+	}
+}
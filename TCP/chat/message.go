@@ -1,11 +1,79 @@
 package chat
 
-import "encoding/json"
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"main/data"
+)
+
+// >> the largest message accepted, as JSON
+// far below data.MaxPayloadSize, as a chat message is only a line of text
+const maxMessageSize = 64 << 10
+
+var errMessageSize = fmt.Errorf("message larger than %d bytes", maxMessageSize)
+
+// >> the kinds of message
+// requests with a Seq are answered with a message of the same Seq,
+// of the same kind, or kindError
+const (
+	kindText    = ""        // said to the room
+	kindJoin    = "join"    // asks the server to move the user into RoomID
+	kindError   = "error"   // the server refusing a message, Content says why
+	kindResolve = "resolve" // asks for the ID of the room named Content
+	kindCreate  = "create"  // creates a room named Content, answered with its ID
+	kindRename  = "rename"  // names room RoomID Content
+	kindList    = "list"    // asks for the rooms in use, answered with Rooms
+	kindName    = "name"    // sets the name of the user to Content
+	kindLeave   = "leave"   // takes the user out of its room
+	kindWho     = "who"     // asks for the members of the user's room, answered with Users
+	kindDirect  = "direct"  // said to the user named To alone
+)
+
+// >> the codes of kindError messages
+const (
+	codeBadRequest  = 400
+	codeUnknownRoom = 401 // no room has the name
+	codeRoomTaken   = 409 // another room has the name
+	codeUnknownUser = 404 // no user has the name
+	codeNameTaken   = 409 // another user has the name
+	codeNoRooms     = 503 // every room is in use
+)
 
 type message struct {
 	Content string // the data of the message
 	RoomID  int    // the room the user is present in
 	UserIP  string // the IP of the person sending the message
+	Name    string `json:",omitempty"` // the name of the person sending the message
+	Kind    string `json:",omitempty"` // what the message is for, text if empty
+	Code    int    `json:",omitempty"` // why the server refused a message, see kindError
+	Seq     int    `json:",omitempty"` // the request a reply answers, see kindJoin
+
+	To    string     `json:",omitempty"` // see kindDirect
+	Rooms []roomInfo `json:",omitempty"` // see kindList
+	Users []string   `json:",omitempty"` // see kindWho
+}
+
+// >> a room in use, named or with members
+type roomInfo struct {
+	ID      int
+	Name    string `json:",omitempty"`
+	Members int
+}
+
+// >> an error the server replied with
+type replyError struct {
+	Code    int
+	Message string
+}
+
+func (e *replyError) Error() string {
+	return fmt.Sprintf("error %d: %s", e.Code, e.Message)
 }
 
 func (m *message) Marshal() ([]byte, error) {
@@ -20,3 +88,70 @@ func (m *message) Unmarshal(bytes []byte) error {
 	err := json.Unmarshal(bytes, &m)
 	return err
 }
+
+// >> framing
+// a stream carries messages back to back, each as a data.Binary: a 1-byte
+// type, the 4-byte size of the JSON, and the JSON itself
+
+// >> writes messages to a stream
+type encoder struct {
+	w io.Writer
+}
+
+func newEncoder(w io.Writer) *encoder {
+	return &encoder{w: w}
+}
+
+// >> writes a message in a single Write
+// so that messages written at the same time to a net.Conn don't interleave
+func (e *encoder) Encode(m message) error {
+	payload, err := m.Marshal()
+	if err != nil {
+		return err
+	}
+	if len(payload) > maxMessageSize {
+		return errMessageSize
+	}
+
+	var frame bytes.Buffer
+	_, _ = data.Binary(payload).WriteTo(&frame)
+	_, err = e.w.Write(frame.Bytes())
+	return err
+}
+
+// >> reads the messages of a stream, one after another
+type decoder struct {
+	r *bufio.Reader
+}
+
+func newDecoder(r io.Reader) *decoder {
+	return &decoder{r: bufio.NewReader(r)}
+}
+
+// >> reads the next message
+// io.EOF if the stream ended between messages, and
+// io.ErrUnexpectedEOF if it ended part way through one
+func (d *decoder) Decode(m *message) error {
+	// >> the size is checked before anything is allocated for it
+	header, err := d.r.Peek(5)
+	switch {
+	case err == io.EOF && len(header) > 0:
+		return io.ErrUnexpectedEOF
+	case err != nil:
+		return err
+	case header[0] != data.BinaryType:
+		return errors.New("invalid message frame")
+	case binary.BigEndian.Uint32(header[1:]) > maxMessageSize:
+		return errMessageSize
+	}
+
+	var payload data.Binary
+	if _, err := payload.ReadFrom(d.r); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	*m = message{}
+	return m.Unmarshal(payload)
+}
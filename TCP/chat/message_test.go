@@ -1,7 +1,13 @@
 package chat
 
 import (
+	"bytes"
+	"io"
+	"strings"
 	"testing"
+	"testing/iotest"
+
+	"main/data"
 
 	"github.com/stretchr/testify/require"
 )
@@ -31,3 +37,48 @@ func TestUnmarshal(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, expected, expected)
 }
+
+func TestFraming(t *testing.T) {
+	messages := []message{
+		{Content: "first", RoomID: 1, UserIP: "127.0.0.1:8080"},
+		{Content: "", Kind: kindList, Seq: 2},
+		{Content: strings.Repeat("long ", 1000), RoomID: 3},
+	}
+	var stream bytes.Buffer
+	enc := newEncoder(&stream)
+	for _, m := range messages {
+		require.NoError(t, enc.Encode(m))
+	}
+
+	// >> read back to back, however the stream splits them
+	dec := newDecoder(iotest.OneByteReader(&stream))
+	for _, expected := range messages {
+		var actual message
+		require.NoError(t, dec.Decode(&actual))
+		require.Equal(t, expected, actual)
+	}
+	var m message
+	require.Equal(t, io.EOF, dec.Decode(&m))
+}
+
+func TestFramingErrors(t *testing.T) {
+	// >> messages too large to send
+	err := newEncoder(io.Discard).Encode(message{Content: strings.Repeat("x", maxMessageSize)})
+	require.Equal(t, errMessageSize, err)
+
+	var frame bytes.Buffer
+	require.NoError(t, newEncoder(&frame).Encode(message{Content: "hello"}))
+	for name, stream := range map[string][]byte{
+		"truncated header":  frame.Bytes()[:3],
+		"truncated payload": frame.Bytes()[:frame.Len()-1],
+		"wrong type":        append([]byte{data.StringType}, frame.Bytes()[1:]...),
+		"too large":         {data.BinaryType, 0xff, 0xff, 0xff, 0xff},
+		"not json":          {data.BinaryType, 0, 0, 0, 1, '{'},
+	} {
+		var m message
+		require.Error(t, newDecoder(bytes.NewReader(stream)).Decode(&m), name)
+	}
+	var m message
+	err = newDecoder(bytes.NewReader(frame.Bytes()[:3])).Decode(&m)
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+}
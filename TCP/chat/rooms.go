@@ -0,0 +1,101 @@
+package chat
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// >> room names
+// rooms are numbered, from 0 to maxRooms-1, and can be given a name so
+// that users don't have to remember the numbers. names are kept once
+// given, even after everyone left, until the room is renamed
+
+const maxName = 32 // the longest name of a room or user
+
+// >> whether a room can be called name
+// names can't look like IDs, or contain the separator of commands
+func checkRoomName(name string) error {
+	switch {
+	case name == "" || strings.TrimSpace(name) != name:
+		return &replyError{Code: codeBadRequest, Message: fmt.Sprintf("invalid room name %q", name)}
+	case len(name) > maxName:
+		return &replyError{Code: codeBadRequest, Message: fmt.Sprintf("room name longer than %d bytes", maxName)}
+	case strings.Contains(name, separator):
+		return &replyError{Code: codeBadRequest, Message: fmt.Sprintf("room name contains %q", separator)}
+	}
+	if _, err := strconv.Atoi(name); err == nil {
+		return &replyError{Code: codeBadRequest, Message: fmt.Sprintf("room name %q is a number", name)}
+	}
+	return nil
+}
+
+// >> the ID of the room called name
+func (s *server) resolve(name string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id, ok := s.named(name); ok {
+		return id, nil
+	}
+	return -1, &replyError{Code: codeUnknownRoom, Message: fmt.Sprintf("no room is called %q", name)}
+}
+
+// >> the room called name, s.mu must be held
+func (s *server) named(name string) (int, bool) {
+	for id, n := range s.names {
+		if n == name {
+			return id, true
+		}
+	}
+	return -1, false
+}
+
+// >> names the first room not in use
+func (s *server) create(name string) (int, error) {
+	if err := checkRoomName(name); err != nil {
+		return -1, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.named(name); ok {
+		return -1, &replyError{Code: codeRoomTaken, Message: fmt.Sprintf("a room is already called %q", name)}
+	}
+	for id := 0; id < maxRooms; id++ {
+		if _, ok := s.names[id]; !ok && len(s.rooms[id]) == 0 {
+			s.names[id] = name
+			return id, nil
+		}
+	}
+	return -1, &replyError{Code: codeNoRooms, Message: "every room is in use"}
+}
+
+// >> gives a room another name
+func (s *server) rename(id int, name string) error {
+	if id < 0 || id >= maxRooms {
+		return fmt.Errorf("room %d is not between 0 and %d", id, maxRooms-1)
+	}
+	if err := checkRoomName(name); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if other, ok := s.named(name); ok && other != id {
+		return &replyError{Code: codeRoomTaken, Message: fmt.Sprintf("a room is already called %q", name)}
+	}
+	s.names[id] = name
+	return nil
+}
+
+// >> the rooms in use, named or with members, by ID
+func (s *server) list() []roomInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var rooms []roomInfo
+	for id := 0; id < maxRooms; id++ {
+		name, named := s.names[id]
+		if members := len(s.rooms[id]); named || members > 0 {
+			rooms = append(rooms, roomInfo{ID: id, Name: name, Members: members})
+		}
+	}
+	return rooms
+}
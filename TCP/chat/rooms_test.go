@@ -0,0 +1,173 @@
+package chat
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// >> connects a user to the server
+func testUser(t *testing.T, address string) *user {
+	t.Helper()
+	u := &user{}
+	require.NoError(t, u.connect(address))
+	t.Cleanup(func() { _ = u.Connection.Close() })
+	return u
+}
+
+func requireCode(t *testing.T, code int, err error) {
+	t.Helper()
+	var reply *replyError
+	require.True(t, errors.As(err, &reply), "%v", err)
+	require.Equal(t, code, reply.Code)
+}
+
+func TestRoomNames(t *testing.T) {
+	s, address := testServer(t)
+	u := testUser(t, address)
+
+	// >> unknown names are answered with 401
+	_, err := u.ResolveRoomName("lobby")
+	requireCode(t, codeUnknownRoom, err)
+
+	// >> rooms are created in the first room not in use
+	require.NoError(t, u.join(address, 0))
+	lobby, err := u.createRoom("lobby")
+	require.NoError(t, err)
+	require.Equal(t, 1, lobby)
+	id, err := u.ResolveRoomName("lobby")
+	require.NoError(t, err)
+	require.Equal(t, lobby, id)
+
+	// >> names are unique
+	_, err = u.createRoom("lobby")
+	requireCode(t, codeRoomTaken, err)
+	require.NoError(t, u.renameRoom(0, "games"))
+	requireCode(t, codeRoomTaken, u.renameRoom(0, "lobby"))
+
+	// >> renamed rooms lose their old name
+	require.NoError(t, u.renameRoom(lobby, "hall"))
+	_, err = u.ResolveRoomName("lobby")
+	requireCode(t, codeUnknownRoom, err)
+
+	// >> names that can't be told from IDs or commands are refused
+	for _, name := range []string{"", " padded", "42", "a, b", string(make([]byte, maxName+1))} {
+		_, err = u.createRoom(name)
+		requireCode(t, codeBadRequest, err)
+	}
+	requireCode(t, codeBadRequest, u.renameRoom(maxRooms, "nowhere"))
+
+	// >> every room in use is listed
+	rooms, err := u.listRooms()
+	require.NoError(t, err)
+	require.Equal(t, []roomInfo{
+		{ID: 0, Name: "games", Members: 1},
+		{ID: lobby, Name: "hall"},
+	}, rooms)
+
+	// >> until there's none left
+	s.mu.Lock()
+	for id := 0; id < maxRooms; id++ {
+		if _, ok := s.names[id]; !ok {
+			s.names[id] = "taken"
+		}
+	}
+	s.mu.Unlock()
+	_, err = u.createRoom("more")
+	requireCode(t, codeNoRooms, err)
+}
+
+func TestJoinByName(t *testing.T) {
+	s, address := testServer(t)
+	a, b := testUser(t, address), testUser(t, address)
+
+	// >> the first to join a name creates the room, the others find it
+	room, err := a.getRoomID("general")
+	require.NoError(t, err)
+	require.NoError(t, a.join(address, room))
+	again, err := b.getRoomID("general")
+	require.NoError(t, err)
+	require.Equal(t, room, again)
+	require.NoError(t, b.join(address, again))
+	waitMembers(t, s, room, 2)
+
+	// >> & they hear each other, while replies are kept apart
+	require.NoError(t, a.sendMessage("hello"))
+	_, err = b.listRooms()
+	require.NoError(t, err)
+	var msg message
+	select {
+	case msg = <-b.messages:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no message")
+	}
+	require.Equal(t, "hello", msg.Content)
+	require.Equal(t, a.UserIP, msg.UserIP)
+
+	// >> numbers are IDs
+	id, err := b.getRoomID("7")
+	require.NoError(t, err)
+	require.Equal(t, 7, id)
+}
+
+func TestJoinByNameAtOnce(t *testing.T) {
+	_, address := testServer(t)
+	users := make([]*user, 8)
+	for i := range users {
+		users[i] = testUser(t, address)
+	}
+
+	// >> whoever creates the room, the others all find it
+	rooms := make(chan int, len(users))
+	errs := make(chan error, len(users))
+	for _, u := range users {
+		go func(u *user) {
+			room, err := u.getRoomID("busy")
+			rooms <- room
+			errs <- err
+		}(u)
+	}
+	first := <-rooms
+	require.NoError(t, <-errs)
+	for range users[1:] {
+		require.NoError(t, <-errs)
+		require.Equal(t, first, <-rooms)
+	}
+}
+
+func TestUserStaleReply(t *testing.T) {
+	_, address := testServer(t)
+	u := testUser(t, address)
+
+	require.NoError(t, u.join(address, 1))
+
+	// >> the late reply to a request that timed out, left unread
+	// as the reply to the next request arrives
+	u.replies <- message{Kind: kindList, Seq: 99}
+	require.NoError(t, u.send(message{Kind: kindList, Seq: 100}))
+
+	// >> the server answers in order, so the reply has been read by the time
+	// the user hears its own message
+	require.NoError(t, u.sendMessage("hello"))
+	require.Equal(t, "hello", (<-u.messages).Content)
+	select {
+	case reply := <-u.replies:
+		require.Equal(t, 100, reply.Seq)
+	default:
+		t.Fatal("the reply was dropped")
+	}
+}
+
+func TestUserDisconnected(t *testing.T) {
+	s, address := testServer(t)
+	u := testUser(t, address)
+	s.close()
+
+	// >> requests fail once the server is gone
+	_, err := u.listRooms()
+	require.Error(t, err)
+	_, ok := <-u.messages
+	require.False(t, ok)
+}
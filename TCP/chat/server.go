@@ -1,11 +1,330 @@
 package chat
 
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+)
+
 const (
 	maxRooms = 100
 	port     = 11072
+
+	// >> the messages waiting to be sent to a member
+	// one that falls this far behind is disconnected
+	// instead of holding up everyone else
+	outboxSize = 64
 )
 
-func chatListener(address string) []byte {
-	//listener, err := net.Listen("tcp4", address)
+// >> a connection to the server
+type member struct {
+	conn net.Conn
+	addr string       // the IP:port the member is connected from
+	name string       // as the member called itself, unique on the server
+	room int          // the room the member is in, -1 until it joins one
+	out  chan message // messages waiting to be sent to the member
+}
+
+// >> the chat server
+// every member is in at most one room, and hears every message sent to it
+type server struct {
+	mu      sync.Mutex
+	members map[*member]struct{}
+	rooms   map[int]map[*member]struct{} // the members of each room
+	names   map[int]string               // the rooms that have been named, see rooms.go
+	closed  bool
+}
+
+func newServer() *server {
+	return &server{
+		members: make(map[*member]struct{}),
+		rooms:   make(map[int]map[*member]struct{}),
+		names:   make(map[int]string),
+	}
+}
+
+// >> ListenAndServe runs a chat server on address
+// the default port is used if address doesn't have one
+func ListenAndServe(address string) error {
+	listener, err := net.Listen("tcp4", withPort(address))
+	if err != nil {
+		return err
+	}
+	log.Printf("chat: listening on %s\n", listener.Addr())
+	return newServer().serve(listener)
+}
+
+// >> address, on the default port if it doesn't have one
+func withPort(address string) string {
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return net.JoinHostPort(address, fmt.Sprint(port))
+	}
+	return address
+}
+
+// >> accepts connections until the listener is closed
+func (s *server) serve(listener net.Listener) error {
+	defer func() { _ = listener.Close() }()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handle(conn)
+	}
+}
+
+// >> disconnects every member
+func (s *server) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for m := range s.members {
+		_ = m.conn.Close()
+	}
+}
+
+// >> reads the messages of a member until it disconnects
+func (s *server) handle(conn net.Conn) {
+	m := &member{
+		conn: conn,
+		addr: conn.RemoteAddr().String(),
+		room: -1,
+		out:  make(chan message, outboxSize),
+	}
+	if !s.add(m) {
+		_ = conn.Close()
+		return
+	}
+	defer s.remove(m)
+	go m.write()
+
+	dec := newDecoder(conn)
+	for {
+		var msg message
+		if err := dec.Decode(&msg); err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				log.Printf("chat: [%s] %v\n", m.addr, err)
+			}
+			return
+		}
+
+		// >> the sender is who the connection is from
+		// whatever the client claims
+		msg.UserIP, msg.Name = m.addr, m.name
+
+		var (
+			reply = message{Kind: msg.Kind, RoomID: msg.RoomID, Seq: msg.Seq}
+			err   error
+		)
+		switch msg.Kind {
+		case kindText:
+			err = s.broadcast(m, msg)
+		case kindJoin:
+			err = s.join(m, msg.RoomID)
+		case kindResolve:
+			reply.RoomID, err = s.resolve(msg.Content)
+			reply.Content = msg.Content
+		case kindCreate:
+			reply.RoomID, err = s.create(msg.Content)
+			reply.Content = msg.Content
+		case kindRename:
+			err = s.rename(msg.RoomID, msg.Content)
+			reply.Content = msg.Content
+		case kindList:
+			reply.Rooms = s.list()
+		case kindName:
+			err = s.setName(m, msg.Content)
+			reply.Content = msg.Content
+		case kindLeave:
+			err = s.leaveRoom(m)
+		case kindWho:
+			reply.Users, err = s.who(m)
+		case kindDirect:
+			err = s.direct(m, msg)
+		default:
+			err = fmt.Errorf("unknown message kind %q", msg.Kind)
+		}
+
+		// >> errors are always replied to, anything else only when asked
+		switch {
+		case err != nil:
+			code := codeBadRequest
+			var rErr *replyError
+			if errors.As(err, &rErr) {
+				code, err = rErr.Code, errors.New(rErr.Message)
+			}
+			s.reply(m, message{Kind: kindError, Code: code, Content: err.Error(), RoomID: msg.RoomID, Seq: msg.Seq})
+		case msg.Seq != 0 && msg.Kind != kindText:
+			s.reply(m, reply)
+		}
+	}
+}
+
+// >> sends a member its messages, in order
+func (m *member) write() {
+	enc := newEncoder(m.conn)
+	for msg := range m.out {
+		if err := enc.Encode(msg); err != nil {
+			_ = m.conn.Close() // > the reader notices, & removes the member
+		}
+	}
+}
+
+func (s *server) add(m *member) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	s.members[m] = struct{}{}
+	return true
+}
+
+// >> removes a member from the server, & its room
+func (s *server) remove(m *member) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.leave(m)
+	delete(s.members, m)
+	close(m.out)
+	_ = m.conn.Close()
+}
+
+// >> names a member
+// names are unique, so that members can be told apart
+func (s *server) setName(m *member, name string) error {
+	switch {
+	case name == "" || strings.TrimSpace(name) != name:
+		return fmt.Errorf("invalid name %q", name)
+	case len(name) > maxName:
+		return fmt.Errorf("name longer than %d bytes", maxName)
+	case strings.Contains(name, separator):
+		return fmt.Errorf("name contains %q", separator)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for other := range s.members {
+		if other != m && other.name == name {
+			return &replyError{Code: codeNameTaken, Message: fmt.Sprintf("%q is taken", name)}
+		}
+	}
+	m.name = name
+	return nil
+}
+
+// >> moves a member into a room
+func (s *server) join(m *member, room int) error {
+	if room < 0 || room >= maxRooms {
+		return fmt.Errorf("room %d is not between 0 and %d", room, maxRooms-1)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.leave(m)
+	if s.rooms[room] == nil {
+		s.rooms[room] = make(map[*member]struct{})
+	}
+	s.rooms[room][m] = struct{}{}
+	m.room = room
+	return nil
+}
+
+// >> takes a member out of its room, s.mu must be held
+// empty rooms are forgotten
+func (s *server) leave(m *member) {
+	if m.room < 0 {
+		return
+	}
+	delete(s.rooms[m.room], m)
+	if len(s.rooms[m.room]) == 0 {
+		delete(s.rooms, m.room)
+	}
+	m.room = -1
+}
+
+// >> takes a member out of its room, on request
+func (s *server) leaveRoom(m *member) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if m.room < 0 {
+		return errors.New("not in a room")
+	}
+	s.leave(m)
+	return nil
+}
+
+// >> the members of a member's room, by name
+// or by address, for those without a name
+func (s *server) who(m *member) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if m.room < 0 {
+		return nil, errors.New("not in a room")
+	}
+	var names []string
+	for other := range s.rooms[m.room] {
+		if other.name != "" {
+			names = append(names, other.name)
+		} else {
+			names = append(names, other.addr)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// >> sends a message to the member it's addressed to
+// whichever room either is in
+func (s *server) direct(from *member, msg message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if msg.To == "" {
+		return errors.New("no recipient")
+	}
+	for m := range s.members {
+		if m.name == msg.To {
+			msg.Seq, msg.RoomID = 0, -1 // > the recipient didn't ask for it
+			s.send(m, msg)
+			return nil
+		}
+	}
+	return &replyError{Code: codeUnknownUser, Message: fmt.Sprintf("no user is called %q", msg.To)}
+}
+
+// >> sends a message to every member of its room, including the sender
+func (s *server) broadcast(from *member, msg message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if from.room < 0 || from.room != msg.RoomID {
+		return fmt.Errorf("not in room %d", msg.RoomID)
+	}
+	for m := range s.rooms[msg.RoomID] {
+		s.send(m, msg)
+	}
 	return nil
 }
+
+// >> sends a message to a single member
+func (s *server) reply(m *member, msg message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.members[m]; ok {
+		s.send(m, msg)
+	}
+}
+
+// >> queues a message for a member, s.mu must be held
+// members too far behind to take it are disconnected
+func (s *server) send(m *member, msg message) {
+	select {
+	case m.out <- msg:
+	default:
+		log.Printf("chat: [%s] too slow, disconnecting\n", m.addr)
+		_ = m.conn.Close()
+	}
+}
@@ -0,0 +1,176 @@
+package chat
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"main/data"
+
+	"github.com/stretchr/testify/require"
+)
+
+// >> starts a server on a random loopback port
+func testServer(t *testing.T) (*server, string) {
+	t.Helper()
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := newServer()
+	go func() { _ = s.serve(listener) }()
+	t.Cleanup(func() {
+		_ = listener.Close()
+		s.close()
+	})
+	return s, listener.Addr().String()
+}
+
+// >> a client speaking the protocol directly
+type testClient struct {
+	conn net.Conn
+	enc  *encoder
+	dec  *decoder
+}
+
+func dial(t *testing.T, address string) *testClient {
+	t.Helper()
+	conn, err := net.Dial("tcp4", address)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return &testClient{conn: conn, enc: newEncoder(conn), dec: newDecoder(conn)}
+}
+
+func (c *testClient) send(t *testing.T, msg message) {
+	t.Helper()
+	require.NoError(t, c.enc.Encode(msg))
+}
+
+func (c *testClient) receive(t *testing.T) message {
+	t.Helper()
+	require.NoError(t, c.conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+	var msg message
+	require.NoError(t, c.dec.Decode(&msg))
+	return msg
+}
+
+// >> waits for the server to put count members in room
+func waitMembers(t *testing.T, s *server, room, count int) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.rooms[room]) == count
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestServerBroadcast(t *testing.T) {
+	s, address := testServer(t)
+	a, b, c := dial(t, address), dial(t, address), dial(t, address)
+	a.send(t, message{Kind: kindJoin, RoomID: 1})
+	b.send(t, message{Kind: kindJoin, RoomID: 1})
+	c.send(t, message{Kind: kindJoin, RoomID: 2})
+	waitMembers(t, s, 1, 2)
+	waitMembers(t, s, 2, 1)
+
+	// >> everyone in the room hears it, including the sender,
+	// which is who the connection is from, whatever it claims
+	a.send(t, message{Content: "hello", RoomID: 1, UserIP: "10.0.0.1:1"})
+	expected := message{Content: "hello", RoomID: 1, UserIP: a.conn.LocalAddr().String()}
+	require.Equal(t, expected, a.receive(t))
+	require.Equal(t, expected, b.receive(t))
+
+	// >> other rooms don't
+	c.send(t, message{Content: "elsewhere", RoomID: 2})
+	require.Equal(t, "elsewhere", c.receive(t).Content)
+
+	// >> nor do those who left for another room
+	b.send(t, message{Kind: kindJoin, RoomID: 2})
+	waitMembers(t, s, 2, 2)
+	a.send(t, message{Content: "alone", RoomID: 1})
+	require.Equal(t, "alone", a.receive(t).Content)
+	c.send(t, message{Content: "welcome", RoomID: 2})
+	require.Equal(t, "welcome", b.receive(t).Content)
+	require.Equal(t, "welcome", c.receive(t).Content)
+}
+
+func TestServerErrors(t *testing.T) {
+	_, address := testServer(t)
+	c := dial(t, address)
+
+	// >> messages to rooms the sender isn't in
+	c.send(t, message{Content: "hello", RoomID: 3})
+	reply := c.receive(t)
+	require.Equal(t, kindError, reply.Kind)
+	require.Equal(t, "not in room 3", reply.Content)
+
+	// >> rooms that can't exist
+	for _, room := range []int{-1, maxRooms} {
+		c.send(t, message{Kind: kindJoin, RoomID: room})
+		reply = c.receive(t)
+		require.Equal(t, kindError, reply.Kind)
+		require.Equal(t, room, reply.RoomID)
+	}
+
+	// >> & kinds of message it doesn't know
+	c.send(t, message{Kind: "shout"})
+	reply = c.receive(t)
+	require.Equal(t, kindError, reply.Kind)
+}
+
+func TestServerDisconnect(t *testing.T) {
+	s, address := testServer(t)
+	a, b := dial(t, address), dial(t, address)
+	a.send(t, message{Kind: kindJoin, RoomID: 5})
+	b.send(t, message{Kind: kindJoin, RoomID: 5})
+	waitMembers(t, s, 5, 2)
+
+	// >> members that disconnect are removed from their room
+	require.NoError(t, b.conn.Close())
+	waitMembers(t, s, 5, 1)
+	a.send(t, message{Content: "still here", RoomID: 5})
+	require.Equal(t, "still here", a.receive(t).Content)
+
+	// >> & rooms are forgotten once empty
+	require.NoError(t, a.conn.Close())
+	require.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.rooms) == 0 && len(s.members) == 0
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestUserJoin(t *testing.T) {
+	s, address := testServer(t)
+	listener := dial(t, address)
+	listener.send(t, message{Kind: kindJoin, RoomID: 7})
+	waitMembers(t, s, 7, 1)
+
+	// >> a user connects, joins & talks to the room
+	u := &user{}
+	require.NoError(t, u.join(address, 7))
+	defer func() { _ = u.Connection.Close() }()
+	waitMembers(t, s, 7, 2)
+	_, err := u.handleUserInput("hi all")
+	require.NoError(t, err)
+
+	msg := listener.receive(t)
+	require.Equal(t, "hi all", msg.Content)
+	require.Equal(t, u.Connection.LocalAddr().String(), msg.UserIP)
+
+	require.Error(t, u.join(address, maxRooms))
+}
+
+func TestServerBadFrame(t *testing.T) {
+	s, address := testServer(t)
+	c := dial(t, address)
+	c.send(t, message{Kind: kindJoin, RoomID: 1})
+	waitMembers(t, s, 1, 1)
+
+	// >> a stream that can't be read is disconnected
+	_, err := c.conn.Write([]byte{data.BinaryType, 0xff, 0xff, 0xff, 0xff})
+	require.NoError(t, err)
+	waitMembers(t, s, 1, 0)
+	var msg message
+	require.NoError(t, c.conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+	require.ErrorIs(t, c.dec.Decode(&msg), io.EOF)
+}
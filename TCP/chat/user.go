@@ -1,32 +1,50 @@
 package chat
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net"
 	"strconv"
-	"strings"
+	"sync"
+	"time"
 )
 
 const separator string = ", "
 
-// >> string: command name, int: arg count
-var commands = map[string]int{
-	"JOIN":   2,
-	"SWITCH": 1,
-	"NAME":   1,
-}
+// >> how long to wait for the server to answer a request
+const replyTimeout = 5 * time.Second
 
 type user struct {
 	UserIP      string
 	Name        string
 	CurrentRoom int
 	Connection  net.Conn
+
+	address   string         // the server's, as given on the command line
+	roomNames map[int]string // the names of the rooms joined by name
+	namesMu   sync.Mutex     // guards roomNames, read as messages are shown
+
+	// >> what the server sends, read by listen
+	// replies to requests are kept apart from what's said in the room
+	messages chan message
+	replies  chan message
+	done     chan struct{} // closed once disconnected
+
+	mu  sync.Mutex // held for each request, so replies come in order
+	seq int        // the last request sent
 }
 
 // >> sets the username
-func (u *user) setName(name string) {
+// the server puts it on the user's messages, and refuses names already taken
+func (u *user) setName(name string) error {
+	if u.Connection != nil {
+		if _, err := u.request(message{Kind: kindName, Content: name}); err != nil {
+			return err
+		}
+	}
 	u.Name = name
+	return nil
 }
 
 // >> Lets user join room
@@ -34,91 +52,231 @@ func (u *user) setName(name string) {
 // and should be gotten from the CLI
 func (u *user) join(address string, roomID int) error {
 	var err error
-	if roomID < 0 || roomID > maxRooms {
-		err = fmt.Errorf("error: user attempted to join room id: %d\nmax: %d", roomID, maxRooms)
+	if roomID < 0 || roomID >= maxRooms {
+		err = fmt.Errorf("error: user attempted to join room id: %d\nmax: %d", roomID, maxRooms-1)
 		log.Println(err)
 		return err
 	}
 
-	u.Connection, err = net.Dial("tcp4", address)
+	err = u.connect(address)
 	if err != nil {
-		log.Printf("error: failed to join %s\n", address)
-		log.Println(err)
 		return err
 	}
 
+	// >> the server moves the user into the room
+	_, err = u.request(message{Kind: kindJoin, RoomID: roomID})
+	if err != nil {
+		return err
+	}
+	u.CurrentRoom = roomID
 	return nil
 }
 
-// >> Gets the room ID
-// if raw room ID is given, then simply returns an int of that
-// otherwise if not numeric (room name is provided by user):
-// 		- client asks server if provided name is available
-//		- If yes: server replyes with room ID
-//		- If no:  server replyes with error code 401
-func (u *user) getRoomID(argString string) (int, error) {
-	room, err := strconv.Atoi(argString)
+// >> connects to the server at address, unless already connected
+// and starts listening for what it sends
+func (u *user) connect(address string) error {
+	if u.Connection != nil {
+		return nil
+	}
+	conn, err := net.Dial("tcp4", address)
 	if err != nil {
-		var rErr error
-		room, rErr = u.ResolveRoomName(argString)
-		if rErr != nil {
-			return -1, rErr
+		log.Printf("error: failed to join %s\n", address)
+		log.Println(err)
+		return err
+	}
+	u.Connection = conn
+	u.UserIP = conn.LocalAddr().String()
+	u.CurrentRoom = -1 // > until the user joins one
+	u.messages = make(chan message, outboxSize)
+	u.replies = make(chan message, 1)
+	u.done = make(chan struct{})
+	go u.listen()
+	return nil
+}
+
+// >> reads what the server sends until disconnected
+// messages are dropped if nobody keeps up with reading them. a reply
+// replaces any left unread, which can only answer a request that timed out
+func (u *user) listen() {
+	defer close(u.done)
+	defer close(u.messages)
+	dec := newDecoder(u.Connection)
+	for {
+		var msg message
+		if err := dec.Decode(&msg); err != nil {
+			return
+		}
+		if msg.Seq != 0 {
+			select {
+			case <-u.replies: // > the reply to a request that timed out
+			default:
+			}
+			u.replies <- msg // > listen is the only sender, so there's room
+			continue
+		}
+		select {
+		case u.messages <- msg:
+		default:
+			log.Printf("error: dropped message from %s\n", msg.UserIP)
 		}
 	}
-	return room, nil
 }
 
-// >> Checks if the required argument count is correct
-func checkArgs(argCount int, actual int) error {
-	if argCount != actual {
-		return fmt.Errorf("error: command arg count incorrect\nExpected: %d, Actual: %d", len(args), actual)
+// >> sends a request & waits for the server's reply
+// error replies are returned as a *replyError
+func (u *user) request(msg message) (message, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.seq++
+	msg.Seq = u.seq
+	if err := u.send(msg); err != nil {
+		return message{}, err
+	}
+
+	timeout := time.NewTimer(replyTimeout)
+	defer timeout.Stop()
+	for {
+		select {
+		case reply := <-u.replies:
+			if reply.Seq != msg.Seq {
+				continue // > answers an earlier request, that timed out
+			}
+			if reply.Kind == kindError {
+				return reply, &replyError{Code: reply.Code, Message: reply.Content}
+			}
+			return reply, nil
+		case <-u.done:
+			return message{}, errors.New("error: disconnected from the server")
+		case <-timeout.C:
+			return message{}, errors.New("error: the server didn't reply")
+		}
 	}
-	return nil
 }
 
-// >> Handles user input
-func (u *user) handleUserInput(command string) error {
-	// >> Splitting the command into it's components
-	args := strings.Split(command, separator)
-	argCount := len(args)
+// >> sends a message to the user's current room
+func (u *user) sendMessage(content string) error {
+	return u.send(message{Content: content, RoomID: u.CurrentRoom, UserIP: u.UserIP})
+}
 
-	// >> If command is actually a message
-	if args[0][0] != ':' {
-		u.sendMessage(command)
+// >> writes a message to the server
+func (u *user) send(msg message) error {
+	if u.Connection == nil {
+		return errors.New("error: not connected to a server")
 	}
+	return newEncoder(u.Connection).Encode(msg)
+}
 
-	// >> checking that arguments provided are the same as expected for the command
-	commandType := args[0][:1]
-	err := checkArgs(argCount, commands[commandType])
+// >> Leaves the current room
+func (u *user) leave() error {
+	_, err := u.request(message{Kind: kindLeave})
 	if err != nil {
 		return err
 	}
+	u.CurrentRoom = -1
+	return nil
+}
 
-	// >> Executing command depending on types
-	switch commandType {
-	case "JOIN":
-		room, err := u.getRoomID(args[2])
-		if err != nil {
-			log.Println("error: can't find room %s on server", args[2])
-			return err
-		}
-		u.join(args[1], room)
-		break
+// >> Sends a message to the user called name alone
+func (u *user) sendDirect(name, content string) error {
+	_, err := u.request(message{Kind: kindDirect, To: name, Content: content})
+	return err
+}
 
-	case "SWITCH":
-		room, err := u.getRoomID(args[2])
-		if err != nil {
-			log.Println("error: can't find room %s on server", args[1])
-			return err
-		}
-		u.join(u.Connection.LocalAddr().String(), room)
-		break
+// >> Lists the names of the members of the current room
+func (u *user) who() ([]string, error) {
+	reply, err := u.request(message{Kind: kindWho})
+	if err != nil {
+		return nil, err
+	}
+	return reply.Users, nil
+}
 
-	case "NAME":
-		u.setName(args[1])
-		break
+// >> Resolves a room name into its ID
+// fails with a *replyError of codeUnknownRoom if no room has the name
+func (u *user) ResolveRoomName(name string) (int, error) {
+	reply, err := u.request(message{Kind: kindResolve, Content: name})
+	if err != nil {
+		return -1, err
+	}
+	return reply.RoomID, nil
+}
 
+// >> Creates a room called name, returning its ID
+func (u *user) createRoom(name string) (int, error) {
+	reply, err := u.request(message{Kind: kindCreate, Content: name})
+	if err != nil {
+		return -1, err
 	}
+	return reply.RoomID, nil
+}
 
+// >> Gives a room another name
+// which the user's messages from the room are then shown with
+func (u *user) renameRoom(roomID int, name string) error {
+	if _, err := u.request(message{Kind: kindRename, RoomID: roomID, Content: name}); err != nil {
+		return err
+	}
+	u.namesMu.Lock()
+	defer u.namesMu.Unlock()
+	if u.roomNames == nil {
+		u.roomNames = make(map[int]string)
+	}
+	u.roomNames[roomID] = name
 	return nil
 }
+
+// >> Lists the rooms in use on the server
+func (u *user) listRooms() ([]roomInfo, error) {
+	reply, err := u.request(message{Kind: kindList})
+	if err != nil {
+		return nil, err
+	}
+	return reply.Rooms, nil
+}
+
+// >> Gets the room ID
+// if raw room ID is given, then simply returns an int of that
+// otherwise if not numeric (room name is provided by user):
+// 		- client asks server if provided name is available
+//		- If yes: server replyes with room ID
+//		- If no:  server replyes with error code 401,
+//		          and the room is created
+func (u *user) getRoomID(argString string) (int, error) {
+	room, err := strconv.Atoi(argString)
+	if err != nil {
+		var rErr error
+		room, rErr = u.resolveOrCreate(argString)
+		if rErr != nil {
+			return -1, rErr
+		}
+		u.namesMu.Lock()
+		if u.roomNames == nil {
+			u.roomNames = make(map[int]string)
+		}
+		u.roomNames[room] = argString
+		u.namesMu.Unlock()
+	}
+	return room, nil
+}
+
+// >> the room called name, created if there's none
+// another user can create it between the two requests, as when both join
+// a new name at once, in which case it's resolved again
+func (u *user) resolveOrCreate(name string) (int, error) {
+	var (
+		room  int
+		err   error
+		reply *replyError
+	)
+	for attempt := 0; attempt < 3; attempt++ {
+		room, err = u.ResolveRoomName(name)
+		if !errors.As(err, &reply) || reply.Code != codeUnknownRoom {
+			return room, err
+		}
+		room, err = u.createRoom(name)
+		if !errors.As(err, &reply) || reply.Code != codeRoomTaken {
+			return room, err
+		}
+	}
+	return room, err
+}
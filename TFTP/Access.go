@@ -0,0 +1,93 @@
+package tftp
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ParseNetworks parses a comma separated list of CIDR networks,
+// such as "10.0.0.0/8,192.168.1.7". A bare IP is a network of one address.
+func ParseNetworks(list string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, s := range strings.Split(list, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") { // > a single address
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid network %q", s)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q", s)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// >> checks the client against the server's deny & allow lists
+// the deny list wins, and an empty allow list allows everyone
+func (s *Server) allowed(ip net.IP) bool {
+	for _, network := range s.Deny {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	if len(s.Allow) == 0 {
+		return true
+	}
+	for _, network := range s.Allow {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// >> decides whether a client may start a transfer, and counts it if so
+// done under the lock, so that Shutdown can't start waiting before it's
+// counted. the returned error packet is nil when the request is dropped
+// silently, during a shutdown
+func (s *Server) startTransfer(ip string) (bool, *Err) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.inShutdown {
+		return false, nil
+	}
+	if s.MaxTransfers > 0 && s.active >= s.MaxTransfers {
+		return false, &Err{Error: ErrUnknown, Message: "too many transfers, try again later"}
+	}
+	if s.MaxPerClient > 0 && s.perClient[ip] >= s.MaxPerClient {
+		return false, &Err{Error: ErrUnknown, Message: "too many transfers from this address"}
+	}
+
+	if s.perClient == nil {
+		s.perClient = make(map[string]int)
+	}
+	s.active++
+	s.perClient[ip]++
+	s.transfers.Add(1)
+	return true, nil
+}
+
+func (s *Server) endTransfer(ip string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.active--
+	s.perClient[ip]--
+	if s.perClient[ip] == 0 {
+		delete(s.perClient, ip)
+	}
+	s.transfers.Done()
+}
@@ -0,0 +1,111 @@
+package tftp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseNetworks(t *testing.T) {
+	networks, err := ParseNetworks("10.0.0.0/8, 192.168.1.7,,::1")
+	require.NoError(t, err)
+	require.Len(t, networks, 3)
+	require.True(t, networks[0].Contains(net.ParseIP("10.1.2.3")))
+	require.True(t, networks[1].Contains(net.ParseIP("192.168.1.7")))
+	require.False(t, networks[1].Contains(net.ParseIP("192.168.1.8")))
+	require.True(t, networks[2].Contains(net.ParseIP("::1")))
+
+	_, err = ParseNetworks("10.0.0.0/33")
+	require.Error(t, err)
+	_, err = ParseNetworks("nope")
+	require.Error(t, err)
+}
+
+func TestServerAccess(t *testing.T) {
+	root := fstest.MapFS{"file.txt": {Data: []byte("hello")}}
+	loopback, err := ParseNetworks("127.0.0.0/8")
+	require.NoError(t, err)
+	other, err := ParseNetworks("10.0.0.0/8")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		allow   []*net.IPNet
+		deny    []*net.IPNet
+		allowed bool
+	}{
+		{"open", nil, nil, true},
+		{"allowed", loopback, nil, true},
+		{"not allowed", other, nil, false},
+		{"denied", nil, loopback, false},
+		{"deny wins", loopback, loopback, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := testServer(t, &Server{Root: root, Allow: tt.allow, Deny: tt.deny})
+			r, err := Client{Timeout: time.Second, Retries: 1}.Get(context.Background(), addr.String(), "file.txt")
+			if tt.allowed {
+				require.NoError(t, err)
+				_ = r.Close()
+				return
+			}
+			var rErr *RemoteError
+			require.True(t, errors.As(err, &rErr), err)
+			require.Equal(t, ErrAccessViolation, rErr.Code)
+		})
+	}
+}
+
+func TestServerLimits(t *testing.T) {
+	file := bytes.Repeat([]byte("x"), 10*BlockSize)
+	root := fstest.MapFS{"file.bin": {Data: file}}
+	for _, s := range []*Server{
+		{Root: root, Timeout: time.Second, MaxPerClient: 1},
+		{Root: root, Timeout: time.Second, MaxTransfers: 1},
+	} {
+		addr := testServer(t, s)
+		c := Client{Timeout: time.Second, Retries: 1}
+
+		// >> a transfer that stalls after the first block holds the only slot
+		r, err := c.Get(context.Background(), addr.String(), "file.bin")
+		require.NoError(t, err)
+
+		_, err = c.Get(context.Background(), addr.String(), "file.bin")
+		var rErr *RemoteError
+		require.True(t, errors.As(err, &rErr), err)
+		require.Equal(t, ErrUnknown, rErr.Code)
+
+		// >> the slot is freed once the transfer is over
+		_ = r.Close()
+		require.Eventually(t, func() bool {
+			r, err := c.Get(context.Background(), addr.String(), "file.bin")
+			if err != nil {
+				return false
+			}
+			_ = r.Close()
+			return true
+		}, 5*time.Second, 50*time.Millisecond)
+	}
+}
+
+func TestServerLimitsWrite(t *testing.T) {
+	file := bytes.Repeat([]byte("x"), 3*BlockSize)
+	for _, s := range []*Server{
+		{Root: fstest.MapFS{}, Uploads: DirSink(t.TempDir()), Timeout: time.Second, MaxPerClient: 1},
+		{Root: fstest.MapFS{}, Uploads: DirSink(t.TempDir()), Timeout: time.Second, MaxTransfers: 1},
+	} {
+		addr := testServer(t, s)
+		c := Client{Timeout: time.Second, Retries: 1}
+
+		// >> the slot is freed as soon as an upload completes
+		// not after the dally that follows it
+		require.NoError(t, c.Put(context.Background(), addr.String(), "first.bin", bytes.NewReader(file)))
+		require.NoError(t, c.Put(context.Background(), addr.String(), "second.bin", bytes.NewReader(file)))
+	}
+}
@@ -0,0 +1,323 @@
+package tftp
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"testing/quick"
+
+	"github.com/stretchr/testify/require"
+)
+
+// >> property tests
+// packets marshalled from any value either round trip, or are refused
+// because a field can't be represented, such as one with a 0 byte
+
+// >> whether s can be a field of a packet
+func validField(s string) bool {
+	return s != "" && !strings.ContainsRune(s, 0)
+}
+
+func validOptions(opts map[string]string) bool {
+	for name, value := range opts {
+		if !validField(name) || !validField(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// >> the options as they're read, with lower cased names
+// a name that differs only in case from another makes the options ambiguous
+func readableOptions(opts map[string]string) (map[string]string, bool) {
+	if len(opts) == 0 {
+		return nil, true
+	}
+	lower := make(map[string]string, len(opts))
+	for name, value := range opts {
+		if _, ok := lower[strings.ToLower(name)]; ok {
+			return nil, false
+		}
+		lower[strings.ToLower(name)] = value
+	}
+	return lower, true
+}
+
+func TestReadReqProperties(t *testing.T) {
+	roundTrip := func(filename string, netascii bool, opts map[string]string) bool {
+		mode := ModeOctet
+		if netascii {
+			mode = ModeNetASCII
+		}
+		data, err := ReadReq{Filename: filename, Mode: mode, Options: opts}.MarshalBinary()
+		if !validField(filename) || !validOptions(opts) {
+			return err != nil
+		}
+		expected, ok := readableOptions(opts)
+		if err != nil || !ok {
+			return err == nil && !ok
+		}
+		var q ReadReq
+		if err := q.UnmarshalBinary(data); err != nil {
+			return false
+		}
+		return q.Filename == filename && q.Mode == mode && equalOptions(q.Options, expected)
+	}
+	require.NoError(t, quick.Check(roundTrip, nil))
+
+	// >> the defaulted mode is accounted for, and written
+	data, err := ReadReq{Filename: "f"}.MarshalBinary()
+	require.NoError(t, err)
+	require.Equal(t, "\x00\x01f\x00octet\x00", string(data))
+}
+
+func TestWriteReqProperties(t *testing.T) {
+	roundTrip := func(filename string, opts map[string]string) bool {
+		data, err := WriteReq{Filename: filename, Mode: ModeOctet, Options: opts}.MarshalBinary()
+		if !validField(filename) || !validOptions(opts) {
+			return err != nil
+		}
+		expected, ok := readableOptions(opts)
+		if err != nil || !ok {
+			return err == nil && !ok
+		}
+		var q WriteReq
+		if err := q.UnmarshalBinary(data); err != nil {
+			return false
+		}
+		return q.Filename == filename && q.Mode == ModeOctet && equalOptions(q.Options, expected)
+	}
+	require.NoError(t, quick.Check(roundTrip, nil))
+}
+
+func TestDataProperties(t *testing.T) {
+	roundTrip := func(block uint16, payload []byte) bool {
+		if len(payload) > MaxBlockSize {
+			payload = payload[:MaxBlockSize]
+		}
+		d := Data{Block: block, Payload: bytes.NewReader(payload), Size: len(payload)}
+		if len(payload) == 0 {
+			d.Size = BlockSize
+		}
+		data, err := d.MarshalBinary()
+		if err != nil {
+			return false
+		}
+		var actual Data
+		if err := actual.UnmarshalBinary(data); err != nil {
+			return false
+		}
+		read, err := io.ReadAll(actual.Payload)
+		return err == nil && actual.Block == nextBlock(block, 0) && bytes.Equal(read, payload)
+	}
+	require.NoError(t, quick.Check(roundTrip, nil))
+}
+
+func TestAckProperties(t *testing.T) {
+	roundTrip := func(block uint16) bool {
+		data, err := Ack(block).MarshalBinary()
+		if err != nil {
+			return false
+		}
+		var a Ack
+		return a.UnmarshalBinary(data) == nil && a == Ack(block)
+	}
+	require.NoError(t, quick.Check(roundTrip, nil))
+}
+
+func TestErrProperties(t *testing.T) {
+	roundTrip := func(code uint16, message string) bool {
+		data, err := Err{Error: ErrCode(code), Message: message}.MarshalBinary()
+		if strings.ContainsRune(message, 0) {
+			return err != nil
+		}
+		var e Err
+		if err != nil || e.UnmarshalBinary(data) != nil {
+			return false
+		}
+		if e.Error != ErrCode(code) || e.Message != message {
+			return false
+		}
+
+		// >> the same packet, without the final 0 byte
+		e = Err{}
+		return e.UnmarshalBinary(data[:len(data)-1]) == nil && e.Message == message
+	}
+	require.NoError(t, quick.Check(roundTrip, nil))
+}
+
+func TestOAckProperties(t *testing.T) {
+	roundTrip := func(opts map[string]string) bool {
+		data, err := OAck(opts).MarshalBinary()
+		if len(opts) == 0 || !validOptions(opts) {
+			return err != nil
+		}
+		expected, ok := readableOptions(opts)
+		if err != nil || !ok {
+			return err == nil && !ok
+		}
+		var o OAck
+		return o.UnmarshalBinary(data) == nil && equalOptions(o, expected)
+	}
+	require.NoError(t, quick.Check(roundTrip, nil))
+}
+
+func equalOptions(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, value := range a {
+		if v, ok := b[name]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// >> fuzz targets
+// any packet that unmarshals must marshal back to one that unmarshals
+// to the same value, and nothing may panic
+
+func FuzzReadReq(f *testing.F) {
+	for _, q := range []ReadReq{
+		{Filename: "file.txt"},
+		{Filename: "pxelinux.0", Mode: ModeNetASCII, Options: map[string]string{OptBlockSize: "1468", OptTransferSize: "0"}},
+	} {
+		data, err := q.MarshalBinary()
+		require.NoError(f, err)
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, p []byte) {
+		var q ReadReq
+		if q.UnmarshalBinary(p) != nil {
+			return
+		}
+		data, err := q.MarshalBinary()
+		require.NoError(t, err)
+		var actual ReadReq
+		require.NoError(t, actual.UnmarshalBinary(data))
+		require.Equal(t, q, actual)
+	})
+}
+
+func FuzzWriteReq(f *testing.F) {
+	data, err := WriteReq{Filename: "backup.cfg", Options: map[string]string{OptTransferSize: "1024"}}.MarshalBinary()
+	require.NoError(f, err)
+	f.Add(data)
+	f.Fuzz(func(t *testing.T, p []byte) {
+		var q WriteReq
+		if q.UnmarshalBinary(p) != nil {
+			return
+		}
+		data, err := q.MarshalBinary()
+		require.NoError(t, err)
+		var actual WriteReq
+		require.NoError(t, actual.UnmarshalBinary(data))
+		require.Equal(t, q, actual)
+	})
+}
+
+func FuzzData(f *testing.F) {
+	data, err := (&Data{Payload: strings.NewReader("hello")}).MarshalBinary()
+	require.NoError(f, err)
+	f.Add(data)
+	f.Fuzz(func(t *testing.T, p []byte) {
+		var d Data
+		if d.UnmarshalBinary(p) != nil {
+			return
+		}
+		payload, err := io.ReadAll(d.Payload)
+		require.NoError(t, err)
+
+		// > marshalling writes the block after the one it's given
+		again := Data{Block: d.Block - 1, Payload: bytes.NewReader(payload), Size: len(payload)}
+		if len(payload) == 0 {
+			again.Size = BlockSize
+		}
+		data, err := again.MarshalBinary()
+		require.NoError(t, err)
+		require.Equal(t, p, data)
+	})
+}
+
+func FuzzAck(f *testing.F) {
+	data, err := Ack(42).MarshalBinary()
+	require.NoError(f, err)
+	f.Add(data)
+	f.Fuzz(func(t *testing.T, p []byte) {
+		var a Ack
+		if a.UnmarshalBinary(p) != nil {
+			return
+		}
+		data, err := a.MarshalBinary()
+		require.NoError(t, err)
+		require.Equal(t, p[:4], data)
+	})
+}
+
+func FuzzErr(f *testing.F) {
+	data, err := Err{Error: ErrNotFound, Message: "file not found"}.MarshalBinary()
+	require.NoError(f, err)
+	f.Add(data)
+	f.Add(data[:len(data)-1])
+	f.Fuzz(func(t *testing.T, p []byte) {
+		var e Err
+		if e.UnmarshalBinary(p) != nil {
+			return
+		}
+		data, err := e.MarshalBinary()
+		require.NoError(t, err)
+		var actual Err
+		require.NoError(t, actual.UnmarshalBinary(data))
+		require.Equal(t, e, actual)
+	})
+}
+
+func FuzzOAck(f *testing.F) {
+	data, err := OAck{OptBlockSize: "1024", OptWindowSize: "4"}.MarshalBinary()
+	require.NoError(f, err)
+	f.Add(data)
+	f.Fuzz(func(t *testing.T, p []byte) {
+		var o OAck
+		if o.UnmarshalBinary(p) != nil {
+			return
+		}
+		data, err := o.MarshalBinary()
+		require.NoError(t, err)
+		var actual OAck
+		require.NoError(t, actual.UnmarshalBinary(data))
+		require.Equal(t, o, actual)
+	})
+}
+
+func FuzzParsePacket(f *testing.F) {
+	for _, pkt := range []Packet{
+		&ReadReq{Filename: "file.txt"},
+		&WriteReq{Filename: "file.txt"},
+		&Data{Payload: strings.NewReader("data")},
+		new(Ack),
+		&Err{Message: "oops"},
+		&OAck{OptTimeout: "1"},
+		&Get{Pattern: "*.img"},
+	} {
+		data, err := pkt.MarshalBinary()
+		require.NoError(f, err)
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, p []byte) {
+		pkt, err := ParsePacket(p)
+		if err != nil {
+			require.Nil(t, pkt)
+			return
+		}
+		if _, ok := pkt.(*Data); ok {
+			return // > covered by FuzzData
+		}
+		data, err := pkt.MarshalBinary()
+		require.NoError(t, err)
+		again, err := ParsePacket(data)
+		require.NoError(t, err)
+		require.Equal(t, pkt, again)
+	})
+}
@@ -0,0 +1,61 @@
+package tftp
+
+import "net"
+
+// >> a transfer's connection with a single client
+// each transfer has its own port, its transfer ID (RFC 1350 section 4).
+// unlike a dialed connection, datagrams from other ports reach it, and
+// are answered with ErrUnknownID rather than ending the transfer
+type peerConn struct {
+	net.PacketConn
+	peer net.Addr
+}
+
+// >> listens on a new port of the same address as the server's listener
+func (s *Server) listenPeer(local, peer net.Addr) (*peerConn, error) {
+	address := ":0"
+	if udpAddr, ok := local.(*net.UDPAddr); ok {
+		address = (&net.UDPAddr{IP: udpAddr.IP, Zone: udpAddr.Zone}).String()
+	}
+	conn, err := s.listenPacket(local.Network(), address)
+	if err != nil {
+		return nil, err
+	}
+	return &peerConn{PacketConn: conn, peer: peer}, nil
+}
+
+// Read reads the next datagram from the peer, skipping any others
+func (c *peerConn) Read(b []byte) (int, error) {
+	for {
+		n, addr, err := c.ReadFrom(b)
+		if err != nil {
+			return n, err
+		}
+		if samePeer(addr, c.peer) {
+			return n, nil
+		}
+		data, err := Err{Error: ErrUnknownID, Message: "unknown transfer id"}.MarshalBinary()
+		if err == nil {
+			_, _ = c.WriteTo(data, addr)
+		}
+	}
+}
+
+// Write sends a datagram to the peer
+func (c *peerConn) Write(b []byte) (int, error) {
+	return c.WriteTo(b, c.peer)
+}
+
+func (c *peerConn) RemoteAddr() net.Addr {
+	return c.peer
+}
+
+// >> whether addr is the peer's address and port
+func samePeer(addr, peer net.Addr) bool {
+	a, ok := addr.(*net.UDPAddr)
+	b, ok2 := peer.(*net.UDPAddr)
+	if !ok || !ok2 {
+		return addr.String() == peer.String()
+	}
+	return a.IP.Equal(b.IP) && a.Port == b.Port
+}
@@ -0,0 +1,188 @@
+package tftp
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// >> a client that drives a transfer one packet at a time
+// so that tests can duplicate, reorder and inject packets
+type rawClient struct {
+	t      *testing.T
+	conn   net.PacketConn
+	server net.Addr // the transfer's address, once the server answered
+	buf    []byte
+}
+
+func newRawClient(t *testing.T) *rawClient {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return &rawClient{t: t, conn: conn, buf: make([]byte, DatagramSize)}
+}
+
+func (c *rawClient) send(pkt interface{ MarshalBinary() ([]byte, error) }, to net.Addr) {
+	data, err := pkt.MarshalBinary()
+	require.NoError(c.t, err)
+	_, err = c.conn.WriteTo(data, to)
+	require.NoError(c.t, err)
+}
+
+func (c *rawClient) ack(block uint16) {
+	c.send(Ack(block), c.server)
+}
+
+// >> the next datagram, or nil if none arrives within wait
+func (c *rawClient) next(wait time.Duration) []byte {
+	require.NoError(c.t, c.conn.SetReadDeadline(time.Now().Add(wait)))
+	n, addr, err := c.conn.ReadFrom(c.buf)
+	if nErr, ok := err.(net.Error); ok && nErr.Timeout() {
+		return nil
+	}
+	require.NoError(c.t, err)
+	if c.server == nil {
+		c.server = addr
+	}
+	require.Equal(c.t, c.server.String(), addr.String())
+	return c.buf[:n]
+}
+
+func (c *rawClient) data(wait time.Duration) uint16 {
+	pkt := c.next(wait)
+	require.NotNil(c.t, pkt, "no data packet")
+	var dataPkt Data
+	require.NoError(c.t, dataPkt.UnmarshalBinary(pkt))
+	return dataPkt.Block
+}
+
+func TestServerDuplicateAck(t *testing.T) {
+	file := bytes.Repeat([]byte("x"), 2*BlockSize+1) // 3 blocks
+	addr := testServer(t, &Server{
+		Root:    fstest.MapFS{"file.bin": {Data: file}},
+		Timeout: time.Second,
+	})
+	c := newRawClient(t)
+	c.send(ReadReq{Filename: "file.bin"}, addr)
+
+	require.Equal(t, uint16(1), c.data(time.Second))
+	// >> the ack is duplicated on the way
+	// only one block 2 is sent, the second ack is ignored
+	c.ack(1)
+	c.ack(1)
+	require.Equal(t, uint16(2), c.data(time.Second))
+	require.Nil(t, c.next(300*time.Millisecond))
+
+	// >> an old ack arriving late doesn't cause a retransmission either
+	c.ack(1)
+	require.Nil(t, c.next(300*time.Millisecond))
+
+	c.ack(2)
+	require.Equal(t, uint16(3), c.data(time.Second))
+	c.ack(3)
+	require.Nil(t, c.next(300*time.Millisecond))
+}
+
+func TestServerReorderedAck(t *testing.T) {
+	file := bytes.Repeat([]byte("x"), 10*BlockSize+1) // 11 blocks
+	addr := testServer(t, &Server{
+		Root:    fstest.MapFS{"file.bin": {Data: file}},
+		Timeout: time.Second,
+	})
+	c := newRawClient(t)
+	c.send(ReadReq{Filename: "file.bin", Options: map[string]string{OptWindowSize: "4"}}, addr)
+	require.NotNil(t, c.next(time.Second)) // > the OACK
+
+	window := func() []uint16 {
+		var blocks []uint16
+		for i := 0; i < 4; i++ {
+			blocks = append(blocks, c.data(time.Second))
+		}
+		return blocks
+	}
+	c.ack(0)
+	require.Equal(t, []uint16{1, 2, 3, 4}, window())
+
+	// >> the acks for the window arrive out of order
+	// the late ack for block 2 is ignored
+	c.ack(4)
+	require.Equal(t, []uint16{5, 6, 7, 8}, window())
+	c.ack(2)
+	require.Nil(t, c.next(300*time.Millisecond))
+
+	// >> a repeated ack asks for the window again, which is resent once
+	c.ack(4)
+	c.ack(4)
+	require.Equal(t, []uint16{5, 6, 7, 8}, window())
+	require.Nil(t, c.next(300*time.Millisecond))
+
+	c.ack(8)
+	require.Equal(t, []uint16{9, 10, 11}, []uint16{c.data(time.Second), c.data(time.Second), c.data(time.Second)})
+	c.ack(11)
+}
+
+func TestServerUnknownTID(t *testing.T) {
+	file := bytes.Repeat([]byte("x"), BlockSize+1) // 2 blocks
+	addr := testServer(t, &Server{
+		Root:    fstest.MapFS{"file.bin": {Data: file}},
+		Timeout: time.Second,
+	})
+	c := newRawClient(t)
+	c.send(ReadReq{Filename: "file.bin"}, addr)
+	require.Equal(t, uint16(1), c.data(time.Second))
+
+	// >> a packet from another port is refused, without ending the transfer
+	stray := newRawClient(t)
+	stray.send(Ack(1), c.server)
+	var errPkt Err
+	require.NoError(t, errPkt.UnmarshalBinary(stray.next(time.Second)))
+	require.Equal(t, ErrUnknownID, errPkt.Error)
+
+	// >> and a malformed packet from the client itself is ignored
+	_, err := c.conn.WriteTo([]byte{0, byte(OpAck), 0}, c.server)
+	require.NoError(t, err)
+	require.Nil(t, c.next(300*time.Millisecond))
+
+	c.ack(1)
+	require.Equal(t, uint16(2), c.data(time.Second))
+	c.ack(2)
+}
+
+func TestServerDuplicateData(t *testing.T) {
+	dir := t.TempDir()
+	addr := testServer(t, &Server{
+		Root:    fstest.MapFS{},
+		Uploads: DirSink(dir),
+		Timeout: time.Second,
+	})
+	c := newRawClient(t)
+	c.send(WriteReq{Filename: "file.txt"}, addr)
+	require.NotNil(t, c.next(time.Second)) // > ack 0
+
+	// >> every data packet arrives twice
+	// the duplicate is dropped rather than written again
+	block := func(n uint16, payload string) {
+		dataPkt := Data{Block: n - 1, Payload: strings.NewReader(payload)} // > marshalling increments the block
+		data, err := dataPkt.MarshalBinary()
+		require.NoError(t, err)
+		for i := 0; i < 2; i++ {
+			_, err = c.conn.WriteTo(data, c.server)
+			require.NoError(t, err)
+		}
+	}
+	full := string(bytes.Repeat([]byte("a"), BlockSize))
+	block(1, full)
+	block(2, "end")
+
+	require.Eventually(t, func() bool {
+		actual, err := os.ReadFile(filepath.Join(dir, "file.txt"))
+		return err == nil && string(actual) == full+"end"
+	}, 3*time.Second, 50*time.Millisecond)
+}
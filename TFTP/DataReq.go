@@ -10,17 +10,38 @@ import (
 type Data struct {
 	Block   uint16
 	Payload io.Reader // the payload can be large
+	Size    int       // the negotiated block size, BlockSize if 0
+
+	// the block number after 65535, either 0 or 1.
+	// only files larger than 65535 blocks wrap around
+	Rollover uint16
+}
+
+// >> the block number following block
+// block numbers are 16 bits, so large files wrap around after 65535.
+// implementations differ on whether they wrap to 0 or 1
+func nextBlock(block, rollover uint16) uint16 {
+	block++
+	if block == 0 {
+		return rollover
+	}
+	return block
 }
 
 // >> Data response
 // create data request
-// returns 516 bytes, will syphon these bytes from the payload
+// returns Size + 4 bytes, will syphon these bytes from the payload
 func (d *Data) MarshalBinary() ([]byte, error) {
+	size := d.Size
+	if size == 0 {
+		size = BlockSize
+	}
+
 	// >> creatin byte slice
 	b := new(bytes.Buffer)
-	b.Grow(DatagramSize)
+	b.Grow(size + 4)
 
-	d.Block++                                        // block numbers increment from 1
+	d.Block = nextBlock(d.Block, d.Rollover)         // block numbers increment from 1
 	err := binary.Write(b, binary.BigEndian, OpData) // write operation code
 	if err != nil {
 		return nil, err
@@ -32,8 +53,8 @@ func (d *Data) MarshalBinary() ([]byte, error) {
 	}
 
 	// payload
-	// write up to BlockSize worth of bytes
-	_, err = io.CopyN(b, d.Payload, BlockSize)
+	// write up to size worth of bytes
+	_, err = io.CopyN(b, d.Payload, int64(size))
 	if err != nil && err != io.EOF {
 		return nil, err
 	}
@@ -43,7 +64,7 @@ func (d *Data) MarshalBinary() ([]byte, error) {
 
 func (d *Data) UnmarshalBinary(p []byte) error {
 	// >> Sanity Check
-	if l := len(p); l < 4 || l > DatagramSize {
+	if l := len(p); l < 4 || l > MaxBlockSize+4 {
 		return errors.New("invalid DATA")
 	}
 
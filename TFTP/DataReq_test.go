@@ -0,0 +1,29 @@
+package tftp
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDataRollover(t *testing.T) {
+	for rollover, expected := range map[uint16][]uint16{
+		0: {65534, 65535, 0, 1},
+		1: {65534, 65535, 1, 2},
+	} {
+		dataPkt := Data{
+			Block:    65533,
+			Payload:  bytes.NewReader(make([]byte, 4*BlockSize)),
+			Rollover: rollover,
+		}
+		for _, block := range expected {
+			data, err := dataPkt.MarshalBinary()
+			require.NoError(t, err)
+
+			var actual Data
+			require.NoError(t, actual.UnmarshalBinary(data))
+			require.Equal(t, block, actual.Block)
+		}
+	}
+}
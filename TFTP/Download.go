@@ -0,0 +1,147 @@
+package tftp
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrChecksum is returned by Download when a file doesn't match its checksum.
+var ErrChecksum = errors.New("checksum mismatch")
+
+// >> the settings of Download
+type DownloadOptions struct {
+	// fail unless the server has a checksum of the file to verify it against,
+	// otherwise files without one are downloaded unverified
+	RequireChecksum bool
+
+	// the number of times the transfer is attempted, 3 if 0. TFTP can't
+	// resume a transfer part way, so each attempt starts over
+	Attempts int
+
+	// don't ask the server for the size of the file to check the download
+	// against, for servers that mishandle the tsize option
+	SkipTransferSize bool
+}
+
+// >> Download fetches filename from the server at addr into the file dest
+// the file is written to a temporary file next to dest, which is renamed
+// to dest once complete, so dest is never left partly written. the
+// download is checked against the size the server announces, unless that's
+// skipped, and against the SHA-256 in the sidecar file filename+".sha256" if
+// the server has one, in the format of sha256sum. failed transfers, of the
+// file or its sidecar, are retried, but errors sent by the server, such as
+// a missing file, and checksum mismatches aren't
+func (c Client) Download(ctx context.Context, addr, filename, dest string, opts DownloadOptions) error {
+	c.TransferSize = !opts.SkipTransferSize
+	attempts := opts.Attempts
+	if attempts <= 0 {
+		attempts = 3
+	}
+
+	var (
+		sum     []byte
+		fetched bool // > the sidecar, by the first attempt to get it
+		err     error
+	)
+	for i := 1; ; i++ {
+		if !fetched {
+			sum, err = c.checksum(ctx, addr, filename)
+			fetched = err == nil
+			if fetched && sum == nil && opts.RequireChecksum {
+				return fmt.Errorf("no checksum for %s", filename)
+			}
+		}
+		if fetched {
+			err = c.download(ctx, addr, filename, dest, sum)
+		}
+		var remote *RemoteError
+		if err == nil || i == attempts || ctx.Err() != nil ||
+			errors.As(err, &remote) || errors.Is(err, ErrChecksum) {
+			return err
+		}
+	}
+}
+
+// >> a single attempt at downloading filename into dest
+func (c Client) download(ctx context.Context, addr, filename, dest string, sum []byte) (err error) {
+	f, err := os.CreateTemp(filepath.Dir(dest), "."+filepath.Base(dest)+".*.part")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+		}
+	}()
+
+	r, err := c.Get(ctx, addr, filename)
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, h), r)
+	if cErr := r.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return err
+	}
+	if sum != nil && !bytes.Equal(h.Sum(nil), sum) {
+		return fmt.Errorf("%w: %s has SHA-256 %x, expected %x", ErrChecksum, filename, h.Sum(nil), sum)
+	}
+
+	// >> the file is flushed to disk before it takes the place of dest
+	if err = f.Chmod(0644); err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), dest)
+}
+
+// >> fetches the checksum of filename from its sidecar
+// nil if the server doesn't have one
+func (c Client) checksum(ctx context.Context, addr, filename string) ([]byte, error) {
+	c.Mode = ModeOctet
+	r, err := c.Get(ctx, addr, filename+".sha256")
+	var remote *RemoteError
+	if errors.As(err, &remote) && remote.Code == ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = r.Close() }()
+	data, err := io.ReadAll(io.LimitReader(r, 4096))
+	if err != nil {
+		return nil, err
+	}
+	return parseChecksum(string(data))
+}
+
+// >> reads a SHA-256 in the format of sha256sum
+// "<hex digest>  <filename>", or a bare digest
+func parseChecksum(s string) ([]byte, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return nil, errors.New("empty checksum file")
+	}
+	sum, err := hex.DecodeString(fields[0])
+	if err != nil || len(sum) != sha256.Size {
+		return nil, fmt.Errorf("invalid SHA-256 %q", fields[0])
+	}
+	return sum, nil
+}
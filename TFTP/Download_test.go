@@ -0,0 +1,196 @@
+package tftp
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// >> a filesystem whose files claim to be larger than they are
+// as a server would announce for a file truncated under it
+type growingFS struct {
+	fstest.MapFS
+
+	mu    sync.Mutex
+	opens int
+}
+
+func (g *growingFS) Open(name string) (fs.File, error) {
+	f, err := g.MapFS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	g.mu.Lock()
+	g.opens++
+	g.mu.Unlock()
+	return growingFile{f}, nil
+}
+
+type growingFile struct{ fs.File }
+
+func (f growingFile) Stat() (fs.FileInfo, error) {
+	info, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return growingInfo{info}, nil
+}
+
+type growingInfo struct{ fs.FileInfo }
+
+func (i growingInfo) Size() int64 { return i.FileInfo.Size() + BlockSize }
+
+// >> a connection whose packets are lost on the way out
+type deafConn struct{ net.PacketConn }
+
+func (deafConn) WriteTo(p []byte, _ net.Addr) (int, error) { return len(p), nil }
+
+func TestDownload(t *testing.T) {
+	file := []byte("kernel image")
+	sum := sha256.Sum256(file)
+	root := fstest.MapFS{
+		"vmlinuz":        {Data: file},
+		"vmlinuz.sha256": {Data: []byte(hex.EncodeToString(sum[:]) + "  vmlinuz\n")},
+		"bad":            {Data: file},
+		"bad.sha256":     {Data: []byte(hex.EncodeToString(make([]byte, sha256.Size)))},
+		"unsummed":       {Data: file},
+	}
+	addr := testServer(t, &Server{Root: root, Timeout: time.Second}).String()
+	c := Client{Timeout: time.Second}
+	ctx := context.Background()
+	dir := t.TempDir()
+	files := func() []string {
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		return names
+	}
+
+	// >> verified against the sidecar, and renamed into place
+	dest := filepath.Join(dir, "vmlinuz")
+	require.NoError(t, c.Download(ctx, addr, "vmlinuz", dest, DownloadOptions{RequireChecksum: true}))
+	actual, err := os.ReadFile(dest)
+	require.NoError(t, err)
+	require.Equal(t, file, actual)
+	require.Equal(t, []string{"vmlinuz"}, files())
+
+	// >> a mismatch leaves nothing behind
+	err = c.Download(ctx, addr, "bad", filepath.Join(dir, "bad"), DownloadOptions{})
+	require.ErrorIs(t, err, ErrChecksum)
+	require.Equal(t, []string{"vmlinuz"}, files())
+
+	// >> files without a sidecar are unverified, unless one is required
+	err = c.Download(ctx, addr, "unsummed", filepath.Join(dir, "unsummed"), DownloadOptions{RequireChecksum: true})
+	require.Error(t, err)
+	require.NoError(t, c.Download(ctx, addr, "unsummed", filepath.Join(dir, "unsummed"), DownloadOptions{}))
+	require.Equal(t, []string{"unsummed", "vmlinuz"}, files())
+
+	// >> errors from the server aren't retried
+	err = c.Download(ctx, addr, "missing", filepath.Join(dir, "missing"), DownloadOptions{})
+	var remote *RemoteError
+	require.True(t, errors.As(err, &remote))
+	require.Equal(t, ErrNotFound, remote.Code)
+	require.Equal(t, []string{"unsummed", "vmlinuz"}, files())
+}
+
+func TestDownloadTransferSize(t *testing.T) {
+	file := bytes.Repeat([]byte("truncated"), BlockSize/4)
+	root := &growingFS{MapFS: fstest.MapFS{"file": {Data: file}}}
+	addr := testServer(t, &Server{Root: root, Timeout: time.Second}).String()
+
+	// >> a download ending short of the announced size fails, after its data
+	c := Client{Timeout: time.Second, TransferSize: true}
+	r, err := c.Get(context.Background(), addr, "file")
+	require.NoError(t, err)
+	actual, err := io.ReadAll(r)
+	require.ErrorIs(t, err, ErrTransferSize)
+	require.Equal(t, file, actual)
+	require.NoError(t, r.Close())
+
+	// >> without asking, it can't be told apart
+	c.TransferSize = false
+	r, err = c.Get(context.Background(), addr, "file")
+	require.NoError(t, err)
+	actual, err = io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, file, actual)
+	require.NoError(t, r.Close())
+
+	// >> Download retries it, & leaves nothing behind
+	dir := t.TempDir()
+	root.mu.Lock()
+	root.opens = 0
+	root.mu.Unlock()
+	err = c.Download(context.Background(), addr, "file", filepath.Join(dir, "file"), DownloadOptions{Attempts: 2})
+	require.ErrorIs(t, err, ErrTransferSize)
+	root.mu.Lock()
+	require.Equal(t, 2, root.opens)
+	root.mu.Unlock()
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	// >> unless the size isn't checked
+	dest := filepath.Join(dir, "file")
+	require.NoError(t, c.Download(context.Background(), addr, "file", dest, DownloadOptions{SkipTransferSize: true}))
+	actual, err = os.ReadFile(dest)
+	require.NoError(t, err)
+	require.Equal(t, file, actual)
+}
+
+func TestDownloadRetrySidecar(t *testing.T) {
+	file := []byte("kernel image")
+	sum := sha256.Sum256(file)
+	addr := testServer(t, &Server{Root: fstest.MapFS{
+		"vmlinuz":        {Data: file},
+		"vmlinuz.sha256": {Data: []byte(hex.EncodeToString(sum[:]))},
+	}, Timeout: time.Second}).String()
+
+	// >> the request for the sidecar is lost, the first time
+	var transfers []string
+	c := Client{Timeout: 100 * time.Millisecond, Retries: 1}
+	c.ListenPacket = func(network, address string) (net.PacketConn, error) {
+		conn, err := net.ListenPacket(network, address)
+		transfers = append(transfers, address)
+		if err == nil && len(transfers) == 1 {
+			return deafConn{conn}, nil
+		}
+		return conn, err
+	}
+	dest := filepath.Join(t.TempDir(), "vmlinuz")
+	require.NoError(t, c.Download(context.Background(), addr, "vmlinuz", dest, DownloadOptions{RequireChecksum: true}))
+	require.Len(t, transfers, 3) // > the sidecar, again, & the file
+	actual, err := os.ReadFile(dest)
+	require.NoError(t, err)
+	require.Equal(t, file, actual)
+}
+
+func TestParseChecksum(t *testing.T) {
+	sum := sha256.Sum256([]byte("x"))
+	digest := hex.EncodeToString(sum[:])
+	for _, s := range []string{digest, digest + "\n", digest + "  file.img\n", digest + " *file.img"} {
+		actual, err := parseChecksum(s)
+		require.NoError(t, err, s)
+		require.Equal(t, sum[:], actual)
+	}
+	for _, s := range []string{"", "\n", "abc  file", digest[:62]} {
+		_, err := parseChecksum(s)
+		require.Error(t, err, s)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"io"
 	"strings"
 )
 
@@ -13,6 +14,9 @@ type Err struct {
 }
 
 func (e Err) MarshalBinary() ([]byte, error) {
+	if err := checkFields(e.Message); err != nil {
+		return nil, err
+	}
 	// operation code + error code + message + 0 byte
 	cap := 2 + 2 + len(e.Message) + 1
 	b := new(bytes.Buffer)
@@ -58,7 +62,12 @@ func (e *Err) UnmarshalBinary(p []byte) error {
 		return err
 	}
 
+	// > some implementations leave out the final 0 byte, the message
+	// is then the rest of the packet
 	e.Message, err = r.ReadString(0)
 	e.Message = strings.TrimRight(e.Message, "\x00") // remove the 0-byte
+	if err == io.EOF {
+		err = nil
+	}
 	return err
 }
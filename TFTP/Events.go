@@ -0,0 +1,148 @@
+package tftp
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// Logger is where the server writes its log, *log.Logger satisfies it.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+type EventKind uint8
+
+// >> the events of a transfer
+const (
+	TransferStarted   EventKind = iota + 1 // a request was accepted
+	TransferRetry                          // a packet was resent after a timeout
+	TransferCompleted                      // the file was sent or received in full
+	TransferFailed                         // the transfer ended early, see Event.Err
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case TransferStarted:
+		return "started"
+	case TransferRetry:
+		return "retry"
+	case TransferCompleted:
+		return "completed"
+	case TransferFailed:
+		return "failed"
+	}
+	return fmt.Sprintf("EventKind(%d)", uint8(k))
+}
+
+// Event describes something that happened during a transfer.
+type Event struct {
+	Kind     EventKind
+	Op       OpCode // OpRRQ for downloads, OpWRQ for uploads, OpGet for listings
+	Client   string // the client's address
+	Filename string // the pattern of listings
+
+	Bytes    int64         // the bytes of file data transferred so far
+	Duration time.Duration // the time since the transfer started
+	Err      error         // why the transfer failed
+}
+
+// Observer is notified of the events of every transfer, such as for
+// collecting metrics. It's called from the transfer's goroutine.
+type Observer interface {
+	Observe(Event)
+}
+
+// ObserverFunc is a function that can be used as an Observer.
+type ObserverFunc func(Event)
+
+func (f ObserverFunc) Observe(e Event) { f(e) }
+
+// >> writes to the server's log
+func (s *Server) logf(format string, v ...interface{}) {
+	if s.Logger != nil {
+		s.Logger.Printf(format, v...)
+		return
+	}
+	log.Printf(format, v...)
+}
+
+// >> the logging & events of a single transfer
+type transferLog struct {
+	s     *Server
+	event Event
+	start time.Time
+	done  bool
+}
+
+// >> logs the start of a transfer
+func (s *Server) begin(op OpCode, client, filename string) *transferLog {
+	tl := &transferLog{
+		s:     s,
+		event: Event{Op: op, Client: client, Filename: filename},
+		start: time.Now(),
+	}
+	switch op {
+	case OpWRQ:
+		tl.logf("uploading file: %s", filename)
+	case OpGet:
+		tl.logf("listing files: %q", filename)
+	default:
+		tl.logf("requested file: %s", filename)
+	}
+	tl.emit(TransferStarted)
+	return tl
+}
+
+// >> logs a message, prefixed with the client's address
+func (tl *transferLog) logf(format string, v ...interface{}) {
+	tl.s.logf("[%s] "+format, append([]interface{}{tl.event.Client}, v...)...)
+}
+
+// >> counts bytes of file data that were transferred
+func (tl *transferLog) add(bytes int) {
+	tl.event.Bytes += int64(bytes)
+}
+
+// >> logs that a packet is being resent, after waiting for a reply timed out
+func (tl *transferLog) retry(attempt uint8) {
+	tl.logf("timed out, retrying (%d left)", attempt-1)
+	tl.emit(TransferRetry)
+}
+
+// >> logs the failure of a transfer, the transfer must be abandoned after this
+func (tl *transferLog) fail(format string, v ...interface{}) {
+	tl.event.Err = fmt.Errorf(format, v...)
+	tl.logf("%v", tl.event.Err)
+	tl.done = true
+	tl.emit(TransferFailed)
+}
+
+// >> logs the success of a transfer
+func (tl *transferLog) complete(blocks uint64) {
+	verb := "sent"
+	if tl.event.Op == OpWRQ {
+		verb = "received"
+	}
+	tl.logf("%s %d blocks (%d bytes) in %s", verb, blocks, tl.event.Bytes,
+		time.Since(tl.start).Round(time.Millisecond))
+	tl.done = true
+	tl.emit(TransferCompleted)
+}
+
+// >> makes sure every transfer ends with an event, should be deferred
+func (tl *transferLog) end() {
+	if !tl.done {
+		tl.fail("transfer abandoned")
+	}
+}
+
+func (tl *transferLog) emit(kind EventKind) {
+	if tl.s.Observer == nil {
+		return
+	}
+	e := tl.event
+	e.Kind = kind
+	e.Duration = time.Since(tl.start)
+	tl.s.Observer.Observe(e)
+}
@@ -0,0 +1,150 @@
+package tftp
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// >> Dir serves files from a directory on disk, as a server's root
+// unlike os.DirFS, files whose symlinks lead out of the directory
+// can't be opened, they fail with an access violation
+type Dir string
+
+func (d Dir) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	file, err := inDir(string(d), name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return os.Open(file)
+}
+
+// >> the location on disk of name, a clean path within the directory dir
+// with symlinks resolved, which mustn't lead out of dir. name needn't exist,
+// as for uploads, but its directory must. if name is itself a dangling
+// symlink, it's left unresolved, which opening it for reading or creating
+// it with O_EXCL refuse to follow
+func inDir(dir, name string) (string, error) {
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+	file := filepath.Join(root, filepath.FromSlash(name))
+	resolved, err := filepath.EvalSymlinks(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		parent, pErr := filepath.EvalSymlinks(filepath.Dir(file))
+		if pErr != nil {
+			return "", pErr
+		}
+		resolved, err = filepath.Join(parent, filepath.Base(file)), nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errOutsideRoot
+	}
+	return resolved, nil
+}
+
+// >> an open file, shared by the transfers reading it at the same time
+type sharedFile struct {
+	file fs.File
+	r    io.ReaderAt
+	size int64
+	refs int
+}
+
+// >> opens a file for the client at addr to read
+// from the server's Provider, if it provides it, or else from the root.
+// files that support io.ReaderAt, such as those of Dir, are opened
+// once however many transfers read them, each reading its own section,
+// so memory doesn't grow with the size of files or the number of clients.
+// release must be called once the transfer is over
+func (s *Server) openFile(filename string, client net.Addr) (r io.Reader, size int64, release func(), err error) {
+	name, err := resolvePath(filename)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	if s.Provider != nil {
+		data, err := s.Provider.Provide(name, client)
+		switch {
+		case err == nil:
+			r := bytes.NewReader(data)
+			return io.NewSectionReader(r, 0, r.Size()), r.Size(), func() {}, nil
+		case !errors.Is(err, fs.ErrNotExist):
+			return nil, 0, nil, err
+		}
+	}
+	if f := s.acquire(name, nil); f != nil {
+		return io.NewSectionReader(f.r, 0, f.size), f.size, func() { s.release(name) }, nil
+	}
+
+	file, err := s.Root.Open(name)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, 0, nil, err
+	}
+	if !info.Mode().IsRegular() { // > directories & devices can't be sent
+		_ = file.Close()
+		return nil, 0, nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	ra, ok := file.(io.ReaderAt)
+	if !ok { // > read from start to end, by this transfer alone
+		return file, info.Size(), func() { _ = file.Close() }, nil
+	}
+	f := s.acquire(name, &sharedFile{file: file, r: ra, size: info.Size()})
+	return io.NewSectionReader(f.r, 0, f.size), f.size, func() { s.release(name) }, nil
+}
+
+// >> takes a reference to the open file called name
+// if it isn't open, f is shared in its place, unless nil. if it is,
+// f is closed, having been opened at the same time by another transfer
+func (s *Server) acquire(name string, f *sharedFile) *sharedFile {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if open := s.files[name]; open != nil {
+		open.refs++
+		if f != nil {
+			_ = f.file.Close()
+		}
+		return open
+	}
+	if f == nil {
+		return nil
+	}
+	if s.files == nil {
+		s.files = make(map[string]*sharedFile)
+	}
+	f.refs = 1
+	s.files[name] = f
+	return f
+}
+
+// >> drops a reference to the open file called name
+// closing it once no transfer is reading it
+func (s *Server) release(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := s.files[name]
+	f.refs--
+	if f.refs == 0 {
+		delete(s.files, name)
+		_ = f.file.Close()
+	}
+}
@@ -0,0 +1,175 @@
+package tftp
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// >> a filesystem that counts the files open
+// and can hide their io.ReaderAt, like a filesystem streaming its files
+type countingFS struct {
+	fs.FS
+	sequential bool
+
+	mu    sync.Mutex
+	opens int
+	open  int
+}
+
+func (c *countingFS) Open(name string) (fs.File, error) {
+	f, err := c.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.opens++
+	c.open++
+	if c.sequential {
+		return &countedFile{File: f, fs: c}, nil
+	}
+	return &countedReaderAt{countedFile{File: f, fs: c}}, nil
+}
+
+func (c *countingFS) counts() (opens, open int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.opens, c.open
+}
+
+type countedFile struct {
+	fs.File
+	fs *countingFS
+}
+
+func (f *countedFile) Close() error {
+	f.fs.mu.Lock()
+	f.fs.open--
+	f.fs.mu.Unlock()
+	return f.File.Close()
+}
+
+type countedReaderAt struct{ countedFile }
+
+func (f *countedReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	return f.File.(io.ReaderAt).ReadAt(p, off)
+}
+
+func TestServerSharedFiles(t *testing.T) {
+	file := bytes.Repeat([]byte("0123456789"), 2*BlockSize)
+	root := &countingFS{FS: fstest.MapFS{"image.bin": {Data: file}}}
+	addr := testServer(t, &Server{Root: root, Timeout: time.Second})
+	c := Client{Timeout: time.Second}
+
+	// >> transfers reading the same file at the same time share a handle
+	var readers []io.ReadCloser
+	for i := 0; i < 3; i++ {
+		r, err := c.Get(context.Background(), addr.String(), "image.bin")
+		require.NoError(t, err)
+		readers = append(readers, r)
+	}
+	opens, open := root.counts()
+	require.Equal(t, 1, opens)
+	require.Equal(t, 1, open)
+
+	// >> each reads the whole file, from its own position
+	for i := len(readers) - 1; i >= 0; i-- {
+		actual, err := io.ReadAll(readers[i])
+		require.NoError(t, err)
+		require.Equal(t, file, actual)
+		require.NoError(t, readers[i].Close())
+	}
+
+	// >> the handle is closed with the last transfer
+	require.Eventually(t, func() bool {
+		_, open := root.counts()
+		return open == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestServerSequentialFiles(t *testing.T) {
+	text := []byte("line one\nline two\n")
+	root := &countingFS{FS: fstest.MapFS{"file.txt": {Data: text}}, sequential: true}
+	addr := testServer(t, &Server{Root: root, Timeout: time.Second})
+
+	// >> a file without io.ReaderAt is read by each transfer on its own
+	r, err := Client{Timeout: time.Second}.Get(context.Background(), addr.String(), "file.txt")
+	require.NoError(t, err)
+	actual, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, text, actual)
+	require.NoError(t, r.Close())
+
+	// >> the netascii size of such a file is unknown, so tsize is left out
+	conn, err := net.ListenPacket("udp", "127.0.0.1:")
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+	rrq, err := ReadReq{Filename: "file.txt", Mode: ModeNetASCII, Options: map[string]string{
+		OptTransferSize: "0",
+		OptBlockSize:    "1024",
+	}}.MarshalBinary()
+	require.NoError(t, err)
+	_, err = conn.WriteTo(rrq, addr)
+	require.NoError(t, err)
+
+	buf := make([]byte, DatagramSize)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	n, server, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	var oack OAck
+	require.NoError(t, oack.UnmarshalBinary(buf[:n]))
+	require.Equal(t, OAck{OptBlockSize: "1024"}, oack)
+
+	errPkt, err := Err{Error: ErrUnknown, Message: "done"}.MarshalBinary()
+	require.NoError(t, err)
+	_, err = conn.WriteTo(errPkt, server)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		opens, open := root.counts()
+		return opens == 2 && open == 0
+	}, 3*time.Second, 10*time.Millisecond)
+}
+
+func TestServerSymlinks(t *testing.T) {
+	outside, root, uploads := t.TempDir(), t.TempDir(), t.TempDir()
+	secret := filepath.Join(outside, "secret.txt")
+	require.NoError(t, os.WriteFile(secret, []byte("secret"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "boot.txt"), []byte("boot"), 0644))
+	for link, target := range map[string]string{
+		filepath.Join(root, "escape"):     secret,
+		filepath.Join(root, "outside"):    outside,
+		filepath.Join(root, "link"):       "boot.txt",
+		filepath.Join(uploads, "outside"): outside,
+	} {
+		require.NoError(t, os.Symlink(target, link))
+	}
+	addr := testServer(t, &Server{Root: Dir(root), Uploads: DirSink(uploads), Timeout: time.Second})
+
+	// >> symlinks within the root are followed
+	file, errPkt := readReq(t, addr, "link")
+	require.Nil(t, errPkt)
+	require.Equal(t, "boot", string(file))
+
+	// >> those leading out of it aren't, for files or directories
+	for _, filename := range []string{"escape", "outside/secret.txt"} {
+		_, errPkt = readReq(t, addr, filename)
+		require.NotNil(t, errPkt, filename)
+		require.Equal(t, ErrAccessViolation, errPkt.Error, filename)
+	}
+	errPkt = writeReq(t, addr, "outside/upload.txt", []byte("upload"))
+	require.NotNil(t, errPkt)
+	require.Equal(t, ErrAccessViolation, errPkt.Error)
+	require.NoFileExists(t, filepath.Join(outside, "upload.txt"))
+}
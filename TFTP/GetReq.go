@@ -1,6 +1,69 @@
 package tftp
 
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+// >> Get requests a listing of the files under the server's root
+// an extension of TFTP, using OpGet. the listing is sent back as data
+// packets, like the file of a read request, with a line per file:
+// its name, a tab, and its size in bytes
 type Get struct {
-	Error   ErrCode
-	Message string
+	Pattern string            // a path.Match pattern the names must match, all files if empty
+	Options map[string]string // optional, such as OptBlockSize (RFC 2347)
+}
+
+func (q Get) MarshalBinary() ([]byte, error) {
+	if err := checkFields(q.Pattern); err != nil {
+		return nil, err
+	}
+	// operation code + pattern + 0 byte
+	cap := 2 + len(q.Pattern) + 1
+	b := new(bytes.Buffer)
+	b.Grow(cap)
+	err := binary.Write(b, binary.BigEndian, OpGet) // write operation code
+	if err != nil {
+		return nil, err
+	}
+	_, err = b.WriteString(q.Pattern) // write pattern
+	if err != nil {
+		return nil, err
+	}
+	err = b.WriteByte(0) // write 0 byte
+	if err != nil {
+		return nil, err
+	}
+	err = writeOptions(b, q.Options) // write options
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (q *Get) UnmarshalBinary(p []byte) error {
+	r := bytes.NewBuffer(p)
+
+	var code OpCode
+	err := binary.Read(r, binary.BigEndian, &code) // read operation code
+	if err != nil {
+		return err
+	}
+	if code != OpGet {
+		return errors.New("invalid GET")
+	}
+
+	q.Pattern, err = r.ReadString(0) // > the pattern may be empty
+	if err != nil {
+		return errors.New("invalid GET")
+	}
+	q.Pattern = strings.TrimRight(q.Pattern, "\x00") // remove the 0-byte
+
+	q.Options, err = readOptions(r)
+	if err != nil {
+		return errors.New("invalid GET")
+	}
+	return nil
 }
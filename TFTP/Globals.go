@@ -1,8 +1,15 @@
 package tftp
 
 const (
-	DatagramSize = 516              // the maximum supported datagram size
+	DatagramSize = 516              // the default datagram size
 	BlockSize    = DatagramSize - 4 // the DatagramSize minus a 4-byte header
+
+	// >> the range of block sizes that can be negotiated (RFC 2348)
+	MinBlockSize = 8
+	MaxBlockSize = 65464
+
+	// >> the largest window that can be negotiated (RFC 7440)
+	MaxWindowSize = 65535
 )
 
 type OpCode uint16
@@ -11,11 +18,12 @@ type ErrCode uint16
 // >> operation codes
 const (
 	OpRRQ  OpCode = iota + 1
-	_             // no WRQ support (write request)
+	OpWRQ         // write request
 	OpData        // get data
 	OpAck         // Ack
 	OpErr         // Error
-	OpGet         // Exsisting files
+	OpOAck        // option Ack
+	OpGet         // list files, an extension (see Get)
 )
 
 // >> Error codes
@@ -28,4 +36,5 @@ const (
 	ErrUnknownID
 	ErrFileExists
 	ErrNoUser
+	ErrNegotiation // options were refused (RFC 2347)
 )
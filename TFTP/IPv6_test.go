@@ -0,0 +1,110 @@
+package tftp
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// >> listens on address, skipping the test if the machine can't
+func listenOrSkip(t *testing.T, network, address string) net.PacketConn {
+	t.Helper()
+	conn, err := net.ListenPacket(network, address)
+	if err != nil {
+		t.Skipf("%s %s unavailable: %v", network, address, err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func getFile(t *testing.T, addr, filename string) []byte {
+	t.Helper()
+	r, err := Client{Timeout: time.Second}.Get(context.Background(), addr, filename)
+	require.NoError(t, err)
+	defer func() { _ = r.Close() }()
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return data
+}
+
+func TestServerIPv6(t *testing.T) {
+	conn := listenOrSkip(t, "udp6", "[::1]:0")
+	s := &Server{Root: fstest.MapFS{"file.txt": {Data: []byte("over IPv6")}}, Timeout: time.Second}
+	go func() { _ = s.Serve(conn) }()
+
+	require.Equal(t, "over IPv6", string(getFile(t, conn.LocalAddr().String(), "file.txt")))
+}
+
+func TestServerLinkLocal(t *testing.T) {
+	// >> a link-local address needs its zone, the interface it's on
+	var address string
+	ifaces, err := net.Interfaces()
+	require.NoError(t, err)
+SEARCH:
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if ok && ipNet.IP.To4() == nil && ipNet.IP.IsLinkLocalUnicast() {
+				address = net.JoinHostPort(ipNet.IP.String()+"%"+iface.Name, "0")
+				break SEARCH
+			}
+		}
+	}
+	if address == "" {
+		t.Skip("no link-local IPv6 address")
+	}
+
+	conn := listenOrSkip(t, "udp6", address)
+	s := &Server{Root: fstest.MapFS{"file.txt": {Data: []byte("on the link")}}, Timeout: time.Second}
+	go func() { _ = s.Serve(conn) }()
+
+	udpAddr := conn.LocalAddr().(*net.UDPAddr)
+	require.NotEmpty(t, udpAddr.Zone)
+	require.Equal(t, "on the link", string(getFile(t, udpAddr.String(), "file.txt")))
+}
+
+func TestListenAndServeAddrs(t *testing.T) {
+	_ = listenOrSkip(t, "udp6", "[::1]:0")
+	s := &Server{Root: fstest.MapFS{"file.txt": {Data: []byte("dual stack")}}, Timeout: time.Second}
+	served := make(chan error, 1)
+	go func() { served <- s.ListenAndServe("127.0.0.1:0", "[::1]:0") }()
+
+	var addrs []net.Addr
+	require.Eventually(t, func() bool {
+		addrs = s.Addrs()
+		return len(addrs) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	for _, addr := range addrs {
+		require.Equal(t, "dual stack", string(getFile(t, addr.String(), "file.txt")), addr)
+	}
+
+	require.NoError(t, s.Shutdown(context.Background()))
+	require.ErrorIs(t, <-served, ErrServerClosed)
+	require.Empty(t, s.Addrs())
+}
+
+func TestListenNetwork(t *testing.T) {
+	for addr, network := range map[string]string{
+		"0.0.0.0:69":           "udp4",
+		"[::]:69":              "udp6",
+		"[fe80::1%eth0]:69":    "udp6",
+		"[::ffff:10.0.0.1]:69": "udp4",
+		":69":                  "udp",
+		"tftp.example:69":      "udp",
+	} {
+		require.Equal(t, network, listenNetwork(addr), addr)
+	}
+}
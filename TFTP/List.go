@@ -0,0 +1,137 @@
+package tftp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ListEntry is a file in a server's listing, see Client.List.
+type ListEntry struct {
+	Name string // the path of the file, relative to the server's root
+	Size int64
+}
+
+// handle sending a listing of the files under the root
+func (s *Server) handleList(ctx context.Context, local, client net.Addr, get Get) {
+	tl := s.begin(OpGet, client.String(), get.Pattern)
+	defer tl.end()
+
+	conn, err := s.listenPeer(local, client)
+	if err != nil {
+		tl.fail("listen: %v", err)
+		return
+	}
+	defer func() { _ = conn.Close() }()
+	stop := abortOnDone(ctx, conn)
+	defer stop()
+
+	listing, err := s.listFiles(get.Pattern)
+	if err != nil {
+		tl.fail("listing %q: %v", get.Pattern, err)
+		if errors.Is(err, path.ErrBadPattern) {
+			writeErr(conn, Err{Error: ErrUnknown, Message: "bad pattern"})
+			return
+		}
+		writeErr(conn, toErrPkt(err))
+		return
+	}
+
+	// >> the listing is sent like a file, options included
+	t, oack := s.negotiate(get.Options, int64(len(listing)))
+	if oack != nil {
+		err = s.sendOAck(conn, oack, t, tl)
+		if err != nil {
+			tl.fail("negotiating options: %v", err)
+			return
+		}
+	}
+	s.send(ctx, conn, bytes.NewReader(listing), t, tl)
+}
+
+// >> lists the regular files under the root whose path matches pattern
+// a line per file, with its name and size separated by a tab. names
+// that can't be told apart from the separators are left out
+func (s *Server) listFiles(pattern string) ([]byte, error) {
+	pattern = strings.TrimPrefix(pattern, "/")
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+
+	b := new(bytes.Buffer)
+	err := fs.WalkDir(s.Root, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || strings.ContainsAny(name, "\t\r\n") {
+			return nil
+		}
+		if pattern != "" {
+			if ok, _ := path.Match(pattern, name); !ok {
+				return nil
+			}
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(b, "%s\t%d\n", name, info.Size())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// List returns the files that the server at addr hosts, whose path matches
+// pattern (see path.Match), or every file if pattern is empty.
+// it uses OpGet, an extension that other servers don't support
+func (c Client) List(ctx context.Context, addr, pattern string) ([]ListEntry, error) {
+	get, err := Get{Pattern: pattern, Options: c.options()}.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	t, err := c.dial(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &download{transfer: t, last: get}
+	defer func() { _ = d.Close() }()
+	err = t.send(get)
+	if err == nil {
+		err = d.next()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return readListing(d)
+}
+
+// >> parses the lines of a listing
+func readListing(r io.Reader) ([]ListEntry, error) {
+	var entries []ListEntry
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		i := strings.LastIndexByte(line, '\t')
+		if i < 0 {
+			return nil, fmt.Errorf("invalid listing line %q", line)
+		}
+		size, err := strconv.ParseInt(line[i+1:], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid listing line %q", line)
+		}
+		entries = append(entries, ListEntry{Name: line[:i], Size: size})
+	}
+	return entries, scanner.Err()
+}
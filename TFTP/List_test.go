@@ -0,0 +1,85 @@
+package tftp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetReq(t *testing.T) {
+	for _, expected := range []Get{
+		{},
+		{Pattern: "*.img"},
+		{Pattern: "pxelinux.cfg/*", Options: map[string]string{OptBlockSize: "1024"}},
+	} {
+		data, err := expected.MarshalBinary()
+		require.NoError(t, err)
+		var actual Get
+		require.NoError(t, actual.UnmarshalBinary(data))
+		require.Equal(t, expected, actual)
+	}
+	require.Error(t, new(Get).UnmarshalBinary([]byte{0, byte(OpGet), 'x'}))
+}
+
+func TestClientList(t *testing.T) {
+	root := fstest.MapFS{
+		"boot.img":                {Data: []byte("kernel")},
+		"initrd.img":              {Data: bytes.Repeat([]byte("x"), 3*BlockSize)},
+		"pxelinux.cfg/default":    {Data: []byte("menu")},
+		"pxelinux.cfg/01-aa-bb":   {Data: []byte("host")},
+		"readme.txt":              {Data: nil},
+		"odd\tname.txt":           {Data: []byte("left out")},
+		"pxelinux.cfg/nested/dir": {Data: []byte("deep")},
+	}
+	addr := testServer(t, &Server{Root: root, Timeout: time.Second})
+	c := Client{Timeout: time.Second}
+
+	entries, err := c.List(context.Background(), addr.String(), "")
+	require.NoError(t, err)
+	require.Equal(t, []ListEntry{
+		{"boot.img", 6},
+		{"initrd.img", 3 * BlockSize},
+		{"pxelinux.cfg/01-aa-bb", 4},
+		{"pxelinux.cfg/default", 4},
+		{"pxelinux.cfg/nested/dir", 4},
+		{"readme.txt", 0},
+	}, entries)
+
+	entries, err = c.List(context.Background(), addr.String(), "*.img")
+	require.NoError(t, err)
+	require.Equal(t, []ListEntry{{"boot.img", 6}, {"initrd.img", 3 * BlockSize}}, entries)
+
+	entries, err = c.List(context.Background(), addr.String(), "/pxelinux.cfg/*")
+	require.NoError(t, err)
+	require.Equal(t, []ListEntry{{"pxelinux.cfg/01-aa-bb", 4}, {"pxelinux.cfg/default", 4}}, entries)
+
+	entries, err = c.List(context.Background(), addr.String(), "*.iso")
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	_, err = c.List(context.Background(), addr.String(), "[")
+	var rErr *RemoteError
+	require.True(t, errors.As(err, &rErr), err)
+	require.Equal(t, "bad pattern", rErr.Message)
+}
+
+func TestClientListOptions(t *testing.T) {
+	// >> a listing spanning many blocks, with a larger block size & window
+	root := fstest.MapFS{}
+	for i := 0; i < 500; i++ {
+		root[fmt.Sprintf("images/%03d.img", i)] = &fstest.MapFile{Data: []byte("img")}
+	}
+	addr := testServer(t, &Server{Root: root, Timeout: time.Second})
+	c := Client{Timeout: time.Second, BlockSize: 1024, WindowSize: 4}
+
+	entries, err := c.List(context.Background(), addr.String(), "images/*")
+	require.NoError(t, err)
+	require.Len(t, entries, 500)
+	require.Equal(t, ListEntry{"images/499.img", 3}, entries[499])
+}
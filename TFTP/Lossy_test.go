@@ -0,0 +1,114 @@
+package tftp
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"main/UDP/lossy"
+
+	"github.com/stretchr/testify/require"
+)
+
+// >> serves s on the simulated network
+func lossyServer(t *testing.T, network *lossy.Network, s *Server) string {
+	t.Helper()
+	s.ListenPacket = network.ListenPacket
+	s.Logger = log.New(io.Discard, "", 0)
+	conn, err := network.ListenPacket("udp", "127.0.0.1:69")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	go func() { _ = s.Serve(conn) }()
+	return conn.LocalAddr().String()
+}
+
+func TestLossyNetwork(t *testing.T) {
+	// >> packets are lost, duplicated and reordered, but not corrupted.
+	// UDP's checksum drops corrupted packets, and TFTP has none of its own
+	network := lossy.NewNetwork(lossy.Config{
+		Seed:      1,
+		Loss:      0.05,
+		Duplicate: 0.1,
+		Reorder:   0.1,
+		Jitter:    5 * time.Millisecond,
+	})
+	dir := t.TempDir()
+	file := make([]byte, 40*BlockSize+100)
+	for i := range file {
+		file[i] = byte(i * 7)
+	}
+	addr := lossyServer(t, network, &Server{
+		Root:    fstest.MapFS{"file.bin": {Data: file}},
+		Uploads: DirSink(dir),
+		Retries: 20,
+		Timeout: 50 * time.Millisecond,
+	})
+
+	for _, windowSize := range []int{1, 4} {
+		c := Client{
+			Retries:      20,
+			Timeout:      50 * time.Millisecond,
+			WindowSize:   windowSize,
+			ListenPacket: network.ListenPacket,
+		}
+		r, err := c.Get(context.Background(), addr, "file.bin")
+		require.NoError(t, err)
+		actual, err := io.ReadAll(r)
+		require.NoError(t, err)
+		require.NoError(t, r.Close())
+		require.Equal(t, file, actual, "window size %d", windowSize)
+
+		name := filepath.Join(dir, "upload.bin")
+		_ = os.Remove(name)
+		err = c.Put(context.Background(), addr, "upload.bin", bytes.NewReader(file))
+		require.NoError(t, err)
+		actual, err = os.ReadFile(name)
+		require.NoError(t, err)
+		require.Equal(t, file, actual, "window size %d", windowSize)
+	}
+}
+
+func TestLossyTimeout(t *testing.T) {
+	network := lossy.NewNetwork(lossy.Config{})
+	events := make(chan Event, 16)
+	file := bytes.Repeat([]byte("x"), 10*BlockSize)
+	addr := lossyServer(t, network, &Server{
+		Root:     fstest.MapFS{"file.bin": {Data: file}},
+		Retries:  3,
+		Timeout:  100 * time.Millisecond,
+		Observer: ObserverFunc(func(e Event) { events <- e }),
+	})
+
+	c := Client{Timeout: time.Second, ListenPacket: network.ListenPacket}
+	r, err := c.Get(context.Background(), addr, "file.bin")
+	require.NoError(t, err)
+	defer func() { _ = r.Close() }()
+	require.Equal(t, TransferStarted, (<-events).Kind)
+
+	// >> the network goes down after the first block
+	// the server resends the block every Timeout, until it runs out of retries
+	network.SetConfig(lossy.Config{Loss: 1})
+	_, err = r.Read(make([]byte, 1))
+	require.NoError(t, err)
+
+	retries := 0
+	for e := range events {
+		if e.Kind == TransferRetry {
+			retries++
+			continue
+		}
+		require.Equal(t, TransferFailed, e.Kind)
+		require.EqualError(t, e.Err, "exhausted retries")
+		require.GreaterOrEqual(t, e.Duration, 300*time.Millisecond)
+		require.Less(t, e.Duration, time.Second)
+		break
+	}
+	require.Equal(t, 3, retries)
+}
@@ -0,0 +1,180 @@
+package tftp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// >> upper bounds of the transfer duration histogram, in seconds
+var durationBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+// Metrics counts the server's transfers, set it as the server's Observer.
+// It's an http.Handler serving the counts in Prometheus' text format.
+type Metrics struct {
+	mu      sync.Mutex
+	ops     map[OpCode]*opMetrics
+	clients map[string]*clientMetrics // keyed by IP, client ports change per transfer
+}
+
+type opMetrics struct {
+	started, completed, failed uint64
+	bytes                      uint64
+	retries                    uint64
+	buckets                    []uint64 // completed transfers, per durationBuckets
+	seconds                    float64  // the total duration of completed transfers
+}
+
+type clientMetrics struct {
+	retries, failed uint64
+}
+
+func (m *Metrics) Observe(e Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.ops == nil {
+		m.ops = make(map[OpCode]*opMetrics)
+		m.clients = make(map[string]*clientMetrics)
+	}
+
+	op := m.ops[e.Op]
+	if op == nil {
+		op = &opMetrics{buckets: make([]uint64, len(durationBuckets))}
+		m.ops[e.Op] = op
+	}
+	host, _, err := net.SplitHostPort(e.Client)
+	if err != nil {
+		host = e.Client
+	}
+	client := m.clients[host]
+	if client == nil {
+		client = new(clientMetrics)
+		m.clients[host] = client
+	}
+
+	switch e.Kind {
+	case TransferStarted:
+		op.started++
+	case TransferRetry:
+		op.retries++
+		client.retries++
+	case TransferCompleted:
+		op.completed++
+		op.bytes += uint64(e.Bytes)
+		seconds := e.Duration.Seconds()
+		op.seconds += seconds
+		for i, bound := range durationBuckets {
+			if seconds <= bound {
+				op.buckets[i]++
+			}
+		}
+	case TransferFailed:
+		op.failed++
+		op.bytes += uint64(e.Bytes)
+		client.failed++
+	}
+}
+
+// >> writes the metrics in Prometheus' text exposition format
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	cw := &countingWriter{w: bw}
+	p := func(format string, v ...interface{}) { _, _ = fmt.Fprintf(cw, format+"\n", v...) }
+	ops := []OpCode{OpRRQ, OpWRQ, OpGet}
+	label := map[OpCode]string{OpRRQ: "read", OpWRQ: "write", OpGet: "list"}
+	get := func(op OpCode) *opMetrics {
+		if o := m.ops[op]; o != nil {
+			return o
+		}
+		return &opMetrics{buckets: make([]uint64, len(durationBuckets))}
+	}
+
+	for _, c := range []struct {
+		name, help string
+		value      func(*opMetrics) uint64
+	}{
+		{"tftp_transfers_started_total", "Transfers accepted.", func(o *opMetrics) uint64 { return o.started }},
+		{"tftp_transfers_completed_total", "Transfers that completed.", func(o *opMetrics) uint64 { return o.completed }},
+		{"tftp_transfers_failed_total", "Transfers that ended early.", func(o *opMetrics) uint64 { return o.failed }},
+		{"tftp_transfer_bytes_total", "Bytes of file data sent (read) or received (write).", func(o *opMetrics) uint64 { return o.bytes }},
+		{"tftp_retries_total", "Packets resent after a timeout.", func(o *opMetrics) uint64 { return o.retries }},
+	} {
+		p("# HELP %s %s", c.name, c.help)
+		p("# TYPE %s counter", c.name)
+		for _, op := range ops {
+			p("%s{op=%q} %d", c.name, label[op], c.value(get(op)))
+		}
+	}
+
+	p("# HELP tftp_transfers_in_progress Transfers that haven't ended yet.")
+	p("# TYPE tftp_transfers_in_progress gauge")
+	for _, op := range ops {
+		o := get(op)
+		p("tftp_transfers_in_progress{op=%q} %d", label[op], o.started-o.completed-o.failed)
+	}
+
+	p("# HELP tftp_transfer_duration_seconds The duration of completed transfers.")
+	p("# TYPE tftp_transfer_duration_seconds histogram")
+	for _, op := range ops {
+		o := get(op)
+		for i, bound := range durationBuckets {
+			p("tftp_transfer_duration_seconds_bucket{op=%q,le=%q} %d", label[op],
+				strconv.FormatFloat(bound, 'g', -1, 64), o.buckets[i])
+		}
+		p("tftp_transfer_duration_seconds_bucket{op=%q,le=\"+Inf\"} %d", label[op], o.completed)
+		p("tftp_transfer_duration_seconds_sum{op=%q} %g", label[op], o.seconds)
+		p("tftp_transfer_duration_seconds_count{op=%q} %d", label[op], o.completed)
+	}
+
+	// >> per client, so the ones that are struggling stand out
+	hosts := make([]string, 0, len(m.clients))
+	for host := range m.clients {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	p("# HELP tftp_client_retries_total Packets resent after a timeout, per client.")
+	p("# TYPE tftp_client_retries_total counter")
+	for _, host := range hosts {
+		p("tftp_client_retries_total{client=%q} %d", host, m.clients[host].retries)
+	}
+	p("# HELP tftp_client_failures_total Transfers that ended early, per client.")
+	p("# TYPE tftp_client_failures_total counter")
+	for _, host := range hosts {
+		p("tftp_client_failures_total{client=%q} %d", host, m.clients[host].failed)
+	}
+
+	if cw.err != nil {
+		return cw.n, cw.err
+	}
+	return cw.n, bw.Flush()
+}
+
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = m.WriteTo(w)
+}
+
+// >> keeps track of the bytes written, and the first error
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
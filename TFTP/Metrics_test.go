@@ -0,0 +1,84 @@
+package tftp
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	var (
+		logs    = new(bytes.Buffer)
+		metrics = new(Metrics)
+		events  = make(chan Event, 16)
+	)
+	s := &Server{
+		Root:    fstest.MapFS{"file.bin": {Data: bytes.Repeat([]byte("x"), 1000)}},
+		Timeout: time.Second,
+		Logger:  log.New(logs, "", 0),
+		Observer: ObserverFunc(func(e Event) {
+			metrics.Observe(e)
+			events <- e
+		}),
+	}
+	addr := testServer(t, s)
+
+	c := Client{Timeout: time.Second}
+	r, err := c.Get(context.Background(), addr.String(), "file.bin")
+	require.NoError(t, err)
+	_, err = io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	_, err = c.Get(context.Background(), addr.String(), "missing.bin")
+	require.Error(t, err)
+
+	// >> waiting for the transfers to end
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, s.Shutdown(ctx))
+	close(events)
+
+	var kinds []EventKind
+	for e := range events {
+		kinds = append(kinds, e.Kind)
+		if e.Kind == TransferCompleted {
+			require.Equal(t, "file.bin", e.Filename)
+			require.Equal(t, int64(1000), e.Bytes)
+		}
+		if e.Kind == TransferFailed {
+			require.Equal(t, "missing.bin", e.Filename)
+			require.Error(t, e.Err)
+		}
+	}
+	require.ElementsMatch(t, []EventKind{
+		TransferStarted, TransferCompleted,
+		TransferStarted, TransferFailed,
+	}, kinds)
+	require.Contains(t, logs.String(), "requested file: file.bin")
+	require.Contains(t, logs.String(), "sent 2 blocks (1000 bytes)")
+
+	// >> the metrics as served over HTTP
+	rec := httptest.NewRecorder()
+	metrics.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	require.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+	body := rec.Body.String()
+	for _, line := range []string{
+		`tftp_transfers_started_total{op="read"} 2`,
+		`tftp_transfers_completed_total{op="read"} 1`,
+		`tftp_transfers_failed_total{op="read"} 1`,
+		`tftp_transfer_bytes_total{op="read"} 1000`,
+		`tftp_transfers_in_progress{op="read"} 0`,
+		`tftp_transfer_duration_seconds_bucket{op="read",le="+Inf"} 1`,
+		`tftp_transfer_duration_seconds_count{op="read"} 1`,
+		`tftp_client_failures_total{client="127.0.0.1"} 1`,
+	} {
+		require.Contains(t, body, line+"\n")
+	}
+}
@@ -0,0 +1,188 @@
+package tftp
+
+import (
+	"errors"
+	"io"
+	"strings"
+)
+
+var errMode = errors.New("only octet & netascii transfers supported")
+
+// >> transfer modes
+const (
+	ModeOctet    = "octet"    // the file is sent as is
+	ModeNetASCII = "netascii" // text, with line endings translated (RFC 764)
+)
+
+// >> checks a request's mode, which is case insensitive
+func validMode(mode string) bool {
+	mode = strings.ToLower(mode)
+	return mode == ModeOctet || mode == ModeNetASCII
+}
+
+func isNetASCII(mode string) bool {
+	return strings.ToLower(mode) == ModeNetASCII
+}
+
+// >> netascii encoding
+// on the wire every line ends with CR LF, and a CR on its own is sent as
+// CR NUL. so LF becomes CR LF, and CR becomes CR NUL
+type netasciiEncoder struct {
+	r       io.Reader
+	pending []byte // encoded bytes that didn't fit in the caller's buffer
+}
+
+func newNetASCIIEncoder(r io.Reader) io.Reader {
+	return &netasciiEncoder{r: r}
+}
+
+func (e *netasciiEncoder) Read(p []byte) (int, error) {
+	if len(e.pending) == 0 {
+		raw := make([]byte, len(p))
+		n, err := e.r.Read(raw)
+		for _, b := range raw[:n] {
+			switch b {
+			case '\n':
+				e.pending = append(e.pending, '\r', '\n')
+			case '\r':
+				e.pending = append(e.pending, '\r', 0)
+			default:
+				e.pending = append(e.pending, b)
+			}
+		}
+		if len(e.pending) == 0 {
+			return 0, err
+		}
+	}
+	n := copy(p, e.pending)
+	e.pending = e.pending[n:]
+	return n, nil
+}
+
+// >> netascii decoding
+// the reverse of netasciiEncoder. a CR can arrive at the end of one block,
+// and what follows it in the next, so the decoder remembers it
+type netasciiDecoder struct {
+	cr bool // the last byte seen was a CR
+}
+
+func (d *netasciiDecoder) decode(dst, src []byte) []byte {
+	for _, b := range src {
+		if d.cr {
+			d.cr = false
+			switch b {
+			case '\n':
+				dst = append(dst, '\n')
+				continue
+			case 0:
+				dst = append(dst, '\r')
+				continue
+			default: // > not valid netascii, the CR is kept
+				dst = append(dst, '\r')
+			}
+		}
+		if b == '\r' {
+			d.cr = true
+			continue
+		}
+		dst = append(dst, b)
+	}
+	return dst
+}
+
+// >> a trailing CR, that turned out not to be followed by anything
+func (d *netasciiDecoder) flush(dst []byte) []byte {
+	if d.cr {
+		d.cr = false
+		dst = append(dst, '\r')
+	}
+	return dst
+}
+
+// >> decodes netascii as it's read
+type netasciiReader struct {
+	netasciiDecoder
+	r       io.ReadCloser
+	pending []byte
+}
+
+func newNetASCIIReader(r io.ReadCloser) io.ReadCloser {
+	return &netasciiReader{r: r}
+}
+
+func (d *netasciiReader) Read(p []byte) (int, error) {
+	for len(d.pending) == 0 {
+		raw := make([]byte, len(p))
+		n, err := d.r.Read(raw)
+		d.pending = d.decode(d.pending[:0], raw[:n])
+		if err == io.EOF {
+			d.pending = d.flush(d.pending)
+		}
+		if err != nil {
+			if len(d.pending) > 0 {
+				break
+			}
+			return 0, err
+		}
+	}
+	n := copy(p, d.pending)
+	d.pending = d.pending[n:]
+	return n, nil
+}
+
+func (d *netasciiReader) Close() error { return d.r.Close() }
+
+// >> decodes netascii as it's written
+type netasciiWriter struct {
+	netasciiDecoder
+	w   io.WriteCloser
+	buf []byte
+}
+
+func newNetASCIIWriter(w io.WriteCloser) io.WriteCloser {
+	return &netasciiWriter{w: w}
+}
+
+func (d *netasciiWriter) Write(p []byte) (int, error) {
+	d.buf = d.decode(d.buf[:0], p)
+	_, err := d.w.Write(d.buf)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// >> writes any trailing CR, then closes the underlying writer
+func (d *netasciiWriter) Close() error {
+	d.buf = d.flush(d.buf[:0])
+	if len(d.buf) > 0 {
+		if _, err := d.w.Write(d.buf); err != nil {
+			_ = d.w.Close()
+			return err
+		}
+	}
+	return d.w.Close()
+}
+
+// >> the size of r's data once encoded as netascii
+func netasciiSize(r io.Reader) (int64, error) {
+	var (
+		size int64
+		buf  = make([]byte, 32*1024)
+	)
+	for {
+		n, err := r.Read(buf)
+		size += int64(n)
+		for _, b := range buf[:n] {
+			if b == '\n' || b == '\r' {
+				size++
+			}
+		}
+		if err == io.EOF {
+			return size, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
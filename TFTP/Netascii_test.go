@@ -0,0 +1,86 @@
+package tftp
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+func TestNetASCII(t *testing.T) {
+	for text, wire := range map[string]string{
+		"":                 "",
+		"plain":            "plain",
+		"line\n":           "line\r\n",
+		"a\nb\r\nc":        "a\r\nb\r\x00\r\nc",
+		"cr\r":             "cr\r\x00",
+		"\r\r\n\n":         "\r\x00\r\x00\r\n\r\n",
+		"nul\x00\rnul\x00": "nul\x00\r\x00nul\x00",
+	} {
+		// >> encoding, one byte at a time to split CR LF pairs across reads
+		encoded, err := io.ReadAll(newNetASCIIEncoder(iotest.OneByteReader(bytes.NewBufferString(text))))
+		require.NoError(t, err)
+		require.Equal(t, wire, string(encoded))
+		size, err := netasciiSize(bytes.NewBufferString(text))
+		require.NoError(t, err)
+		require.Equal(t, int64(len(wire)), size)
+
+		// >> decoding as it's read
+		r := newNetASCIIReader(io.NopCloser(iotest.OneByteReader(bytes.NewBufferString(wire))))
+		decoded, err := io.ReadAll(r)
+		require.NoError(t, err)
+		require.Equal(t, text, string(decoded))
+
+		// >> decoding as it's written
+		b := new(bytes.Buffer)
+		w := newNetASCIIWriter(nopWriteCloser{b})
+		for i := 0; i < len(wire); i++ {
+			_, err = w.Write([]byte{wire[i]})
+			require.NoError(t, err)
+		}
+		require.NoError(t, w.Close())
+		require.Equal(t, text, b.String())
+	}
+}
+
+func TestClientNetASCII(t *testing.T) {
+	dir := t.TempDir()
+	addr := testServer(t, &Server{
+		Root:    os.DirFS(dir),
+		Uploads: DirSink(dir),
+		Timeout: time.Second,
+	})
+	text := bytes.Repeat([]byte("switch config\r\nline two\n"), 100)
+
+	c := Client{Timeout: time.Second, Mode: ModeNetASCII}
+	err := c.Put(context.Background(), addr.String(), "config.txt", bytes.NewReader(text))
+	require.NoError(t, err)
+	stored, err := os.ReadFile(filepath.Join(dir, "config.txt"))
+	require.NoError(t, err)
+	require.Equal(t, text, stored)
+
+	r, err := c.Get(context.Background(), addr.String(), "config.txt")
+	require.NoError(t, err)
+	actual, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	require.Equal(t, text, actual)
+
+	// >> in octet mode, the file is received as it's stored
+	r, err = Client{Timeout: time.Second}.Get(context.Background(), addr.String(), "config.txt")
+	require.NoError(t, err)
+	actual, err = io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	require.Equal(t, text, actual)
+}
@@ -0,0 +1,52 @@
+package tftp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// >> option acknowledgment
+// sent in place of the first DATA/ACK, with the options the server accepted
+type OAck map[string]string
+
+func (o OAck) MarshalBinary() ([]byte, error) {
+	if len(o) == 0 { // > an OACK acknowledges at least one option
+		return nil, errors.New("invalid OACK: no options")
+	}
+	b := new(bytes.Buffer)
+	b.Grow(2 + 64) // operation code + a few options
+
+	err := binary.Write(b, binary.BigEndian, OpOAck) // write operation code
+	if err != nil {
+		return nil, err
+	}
+	err = writeOptions(b, o) // write options
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (o *OAck) UnmarshalBinary(p []byte) error {
+	r := bytes.NewBuffer(p)
+
+	var code OpCode
+	err := binary.Read(r, binary.BigEndian, &code) // read operation code
+	if err != nil {
+		return err
+	}
+	if code != OpOAck {
+		return errors.New("invalid OACK")
+	}
+
+	opts, err := readOptions(r) // read options
+	if err != nil {
+		return err
+	}
+	if len(opts) == 0 {
+		return errors.New("invalid OACK")
+	}
+	*o = opts
+	return nil
+}
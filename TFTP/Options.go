@@ -0,0 +1,183 @@
+package tftp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// >> options clients may append to a request (RFC 2347)
+const (
+	OptBlockSize    = "blksize"    // RFC 2348, bytes of data per packet
+	OptTimeout      = "timeout"    // RFC 2349, seconds to wait before retransmitting
+	OptTransferSize = "tsize"      // RFC 2349, size of the file in bytes
+	OptWindowSize   = "windowsize" // RFC 7440, packets sent before waiting for an ack
+	OptRollover     = "rollover"   // block number to wrap around to, 0 or 1
+)
+
+// >> the largest window a server accepts, unless configured otherwise.
+// the whole window is kept in memory until it's acknowledged
+const defaultMaxWindowSize = 16
+
+// >> writes option & value pairs, each followed by a 0 byte
+// the options are sorted, so the same options always encode the same way
+func writeOptions(b *bytes.Buffer, opts map[string]string) error {
+	names := make([]string, 0, len(opts))
+	for name := range opts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if name == "" || opts[name] == "" {
+			return errors.New("invalid options: empty name or value")
+		}
+		if err := checkFields(name, opts[name]); err != nil {
+			return err
+		}
+		for _, s := range []string{name, opts[name]} {
+			_, err := b.WriteString(s)
+			if err != nil {
+				return err
+			}
+			err = b.WriteByte(0)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// >> checks strings can be written as fields ended by a 0 byte
+// a 0 byte within one would end it early, and shift the fields after it
+func checkFields(fields ...string) error {
+	for _, s := range fields {
+		if strings.IndexByte(s, 0) >= 0 {
+			return fmt.Errorf("invalid field %q: contains a 0 byte", s)
+		}
+	}
+	return nil
+}
+
+// >> reads option & value pairs until r is empty
+// option names are case insensitive, so they're lower cased
+func readOptions(r *bytes.Buffer) (map[string]string, error) {
+	if r.Len() == 0 {
+		return nil, nil
+	}
+	opts := make(map[string]string)
+	for r.Len() > 0 {
+		name, err := r.ReadString(0)
+		if err != nil {
+			return nil, errors.New("invalid options")
+		}
+		value, err := r.ReadString(0)
+		if err != nil {
+			return nil, errors.New("invalid options")
+		}
+		name = strings.ToLower(strings.TrimRight(name, "\x00"))
+		value = strings.TrimRight(value, "\x00")
+		if name == "" || value == "" {
+			return nil, errors.New("invalid options")
+		}
+		opts[name] = value
+	}
+	return opts, nil
+}
+
+// >> the settings a transfer runs with, after option negotiation
+type settings struct {
+	retries    uint8         // the number of times to retry a failed transmission
+	blockSize  int           // bytes of data per packet
+	timeout    time.Duration // the duration to wait for a reply
+	windowSize int           // packets sent before waiting for an ack
+	rollover   uint16        // the block number after 65535
+}
+
+// >> the size of a full data packet
+func (t settings) datagramSize() int { return t.blockSize + 4 }
+
+// >> decides which of the requested options the server accepts
+// size is the size of the file being read, or -1 for uploads.
+// unknown & invalid options are left out of the returned OACK,
+// and the OACK is nil when no options were accepted.
+func (s *Server) negotiate(opts map[string]string, size int64) (settings, OAck) {
+	t := settings{
+		retries:    s.Retries,
+		timeout:    s.Timeout,
+		blockSize:  BlockSize,
+		windowSize: 1,
+	}
+	if t.retries == 0 {
+		t.retries = 10
+	}
+	if t.timeout == 0 {
+		t.timeout = 6 * time.Second
+	}
+	if s.Rollover == 1 {
+		t.rollover = 1
+	}
+	oack := make(OAck)
+
+	if v, err := strconv.Atoi(opts[OptBlockSize]); err == nil && v >= MinBlockSize {
+		t.blockSize = v
+		if limit := s.maxBlockSize(); t.blockSize > limit {
+			t.blockSize = limit // > the server gets the final say
+		}
+		oack[OptBlockSize] = strconv.Itoa(t.blockSize)
+	}
+
+	if v, err := strconv.Atoi(opts[OptTimeout]); err == nil && v >= 1 && v <= 255 {
+		t.timeout = time.Duration(v) * time.Second
+		oack[OptTimeout] = strconv.Itoa(v)
+	}
+
+	if v, err := strconv.Atoi(opts[OptWindowSize]); err == nil && v >= 1 && v <= MaxWindowSize {
+		t.windowSize = v
+		if limit := s.maxWindowSize(); t.windowSize > limit {
+			t.windowSize = limit
+		}
+		oack[OptWindowSize] = strconv.Itoa(t.windowSize)
+	}
+
+	if v := opts[OptRollover]; v == "0" || v == "1" {
+		t.rollover = uint16(v[0] - '0')
+		oack[OptRollover] = v
+	}
+
+	if v, err := strconv.ParseInt(opts[OptTransferSize], 10, 64); err == nil && v >= 0 {
+		switch {
+		case size >= 0: // > a read request asks for the size, with a value of 0
+			oack[OptTransferSize] = strconv.FormatInt(size, 10)
+		default: // > a write request announces the size
+			oack[OptTransferSize] = strconv.FormatInt(v, 10)
+		}
+	}
+
+	if len(oack) == 0 {
+		return t, nil
+	}
+	return t, oack
+}
+
+func (s *Server) maxBlockSize() int {
+	if s.MaxBlockSize >= MinBlockSize && s.MaxBlockSize < MaxBlockSize {
+		return s.MaxBlockSize
+	}
+	return MaxBlockSize
+}
+
+func (s *Server) maxWindowSize() int {
+	if s.MaxWindowSize >= 1 && s.MaxWindowSize < MaxWindowSize {
+		return s.MaxWindowSize
+	}
+	if s.MaxWindowSize == 0 {
+		return defaultMaxWindowSize
+	}
+	return MaxWindowSize
+}
@@ -0,0 +1,55 @@
+package tftp
+
+import (
+	"encoding"
+	"encoding/binary"
+	"errors"
+)
+
+// ErrUnknownOpcode is returned by ParsePacket for an opcode it doesn't know.
+// the other side is answered with an ErrIllegalOp error packet
+var ErrUnknownOpcode = errors.New("unknown opcode")
+
+// Packet is any TFTP packet. ParsePacket returns pointers, so every
+// packet can be marshalled & unmarshalled
+type Packet interface {
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+}
+
+// >> ParsePacket reads the opcode of p and unmarshals the packet it names
+// returning a *ReadReq, *WriteReq, *Data, *Ack, *Err, *OAck or *Get.
+// a *Data's payload reads from p, which must not be reused before it's read
+func ParsePacket(p []byte) (Packet, error) {
+	if len(p) < 2 {
+		return nil, errors.New("invalid packet")
+	}
+
+	var pkt Packet
+	switch OpCode(binary.BigEndian.Uint16(p[:2])) {
+	case OpRRQ:
+		pkt = new(ReadReq)
+	case OpWRQ:
+		pkt = new(WriteReq)
+	case OpData:
+		pkt = new(Data)
+	case OpAck:
+		pkt = new(Ack)
+	case OpErr:
+		pkt = new(Err)
+	case OpOAck:
+		pkt = new(OAck)
+	case OpGet:
+		pkt = new(Get)
+	default:
+		return nil, ErrUnknownOpcode
+	}
+
+	if err := pkt.UnmarshalBinary(p); err != nil {
+		return nil, err
+	}
+	return pkt, nil
+}
+
+// >> the error packet answering a packet with an unknown opcode
+var illegalOp = Err{Error: ErrIllegalOp, Message: "unknown opcode"}
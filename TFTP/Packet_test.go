@@ -0,0 +1,76 @@
+package tftp
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePacket(t *testing.T) {
+	marshal := func(pkt interface{ MarshalBinary() ([]byte, error) }) []byte {
+		data, err := pkt.MarshalBinary()
+		require.NoError(t, err)
+		return data
+	}
+
+	rrq := &ReadReq{Filename: "file.txt", Mode: ModeOctet, Options: map[string]string{OptBlockSize: "1024"}}
+	wrq := &WriteReq{Filename: "file.txt", Mode: ModeNetASCII}
+	ack := Ack(7)
+	errPkt := &Err{Error: ErrNotFound, Message: "file not found"}
+	oack := &OAck{OptTimeout: "3"}
+
+	for _, expected := range []Packet{rrq, wrq, &ack, errPkt, oack} {
+		pkt, err := ParsePacket(marshal(expected))
+		require.NoError(t, err)
+		require.Equal(t, expected, pkt)
+	}
+
+	data := marshal(&Data{Payload: bytes.NewReader([]byte("hello"))})
+	pkt, err := ParsePacket(data)
+	require.NoError(t, err)
+	dataPkt, ok := pkt.(*Data)
+	require.True(t, ok)
+	require.Equal(t, uint16(1), dataPkt.Block)
+	payload, err := io.ReadAll(dataPkt.Payload)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(payload))
+
+	_, err = ParsePacket([]byte{0, 42, 0, 0})
+	require.ErrorIs(t, err, ErrUnknownOpcode)
+	_, err = ParsePacket([]byte{0})
+	require.Error(t, err)
+	_, err = ParsePacket([]byte{0, byte(OpAck), 0})
+	require.Error(t, err)
+	require.NotErrorIs(t, err, ErrUnknownOpcode)
+}
+
+func TestServerIllegalOp(t *testing.T) {
+	file := bytes.Repeat([]byte("x"), BlockSize+1) // 2 blocks
+	addr := testServer(t, &Server{
+		Root:    fstest.MapFS{"file.bin": {Data: file}},
+		Timeout: time.Second,
+	})
+
+	// >> a request with an unknown opcode is answered from the listening port
+	c := newRawClient(t)
+	_, err := c.conn.WriteTo([]byte{0, 42, 'x', 0}, addr)
+	require.NoError(t, err)
+	var errPkt Err
+	require.NoError(t, errPkt.UnmarshalBinary(c.next(time.Second)))
+	require.Equal(t, ErrIllegalOp, errPkt.Error)
+
+	// >> an unknown opcode during a transfer ends it
+	c = newRawClient(t)
+	c.send(ReadReq{Filename: "file.bin"}, addr)
+	require.Equal(t, uint16(1), c.data(time.Second))
+	_, err = c.conn.WriteTo([]byte{0, 42, 0, 1}, c.server)
+	require.NoError(t, err)
+	require.NoError(t, errPkt.UnmarshalBinary(c.next(time.Second)))
+	require.Equal(t, ErrIllegalOp, errPkt.Error)
+	c.ack(1)
+	require.Nil(t, c.next(300*time.Millisecond))
+}
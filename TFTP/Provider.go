@@ -0,0 +1,178 @@
+package tftp
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// >> Provider generates files on request, such as per-host boot configs
+// files it provides are served in place of those under the root
+type Provider interface {
+	// Provide returns the content of the file called name for the client at addr.
+	// name is a clean path, as resolved within the root. it must fail with
+	// fs.ErrNotExist for files it doesn't provide, which are then read from the root
+	Provide(name string, client net.Addr) ([]byte, error)
+}
+
+// >> ProviderFunc lets an ordinary function be a Provider
+type ProviderFunc func(name string, client net.Addr) ([]byte, error)
+
+func (f ProviderFunc) Provide(name string, client net.Addr) ([]byte, error) {
+	return f(name, client)
+}
+
+// >> Host is a machine of an inventory
+// that generated files are rendered for
+type Host struct {
+	Name string            `yaml:"name"`
+	MAC  string            `yaml:"mac"` // such as 52:54:00:12:34:56
+	IP   string            `yaml:"ip"`
+	Vars map[string]string `yaml:"vars"` // anything else the templates need
+}
+
+// >> TemplateData is what templates are executed with
+type TemplateData struct {
+	Host     Host
+	Client   net.IP // the address the request came from
+	Filename string // the requested file, such as pxelinux.cfg/01-52-54-00-12-34-56
+}
+
+// >> TemplateProvider renders files from Go templates, for the hosts of an inventory
+// a file is provided when its name matches one of the patterns of Files and
+// the request is from a known host: one whose IP is the client's, or whose
+// MAC the filename ends with, as in PXELINUX's "pxelinux.cfg/01-<mac>".
+// anything else is read from the root. patterns shouldn't overlap, as
+// which of several matching patterns is used is undefined
+type TemplateProvider struct {
+	Files map[string]*template.Template // the template of each path.Match pattern
+	Hosts []Host
+}
+
+func (p *TemplateProvider) Provide(name string, client net.Addr) ([]byte, error) {
+	var tmpl *template.Template
+	for pattern, t := range p.Files {
+		if ok, _ := path.Match(pattern, name); ok {
+			tmpl = t
+			break
+		}
+	}
+	if tmpl == nil {
+		return nil, fs.ErrNotExist
+	}
+
+	var ip net.IP
+	if udpAddr, ok := client.(*net.UDPAddr); ok {
+		ip = udpAddr.IP
+	}
+	host, ok := p.host(name, ip)
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, TemplateData{Host: host, Client: ip, Filename: name}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// >> the host a file is for
+// by the MAC at the end of its name, or else by the client's IP
+func (p *TemplateProvider) host(name string, ip net.IP) (Host, bool) {
+	mac := macSuffix(name)
+	if mac != nil {
+		for _, h := range p.Hosts {
+			if hw, err := net.ParseMAC(h.MAC); err == nil && bytes.Equal(hw, mac) {
+				return h, true
+			}
+		}
+	}
+	if ip != nil {
+		for _, h := range p.Hosts {
+			if ip.Equal(net.ParseIP(h.IP)) {
+				return h, true
+			}
+		}
+	}
+	return Host{}, false
+}
+
+// >> the hyphen separated MAC a filename ends with, if any
+func macSuffix(name string) net.HardwareAddr {
+	const n = len("00-00-00-00-00-00")
+	if len(name) < n {
+		return nil
+	}
+	mac, err := net.ParseMAC(name[len(name)-n:])
+	if err != nil || !strings.Contains(name[len(name)-n:], "-") {
+		return nil
+	}
+	return mac
+}
+
+// >> the layout of an inventory file
+type inventory struct {
+	Files map[string]string `yaml:"files"` // template file, by pattern
+	Hosts []Host            `yaml:"hosts"`
+}
+
+// >> LoadInventory reads a TemplateProvider from a YAML or JSON inventory file
+// such as:
+//
+//	files:
+//	  pxelinux.cfg/01-*: pxelinux.tmpl
+//	hosts:
+//	  - name: node1
+//	    mac: 52:54:00:12:34:56
+//	    ip: 10.0.0.11
+//	    vars: {role: worker}
+//
+// template files are relative to the inventory's directory
+func LoadInventory(name string) (*TemplateProvider, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var inv inventory
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&inv); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	p := &TemplateProvider{Files: make(map[string]*template.Template, len(inv.Files)), Hosts: inv.Hosts}
+	for pattern, file := range inv.Files {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("%s: pattern %q: %w", name, pattern, err)
+		}
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(filepath.Dir(name), file)
+		}
+		tmpl, err := template.New(filepath.Base(file)).Option("missingkey=error").ParseFiles(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		p.Files[pattern] = tmpl
+	}
+	for i, h := range inv.Hosts {
+		if h.MAC != "" {
+			if _, err := net.ParseMAC(h.MAC); err != nil {
+				return nil, fmt.Errorf("%s: host %d: %w", name, i+1, err)
+			}
+		}
+		if h.IP != "" && net.ParseIP(h.IP) == nil {
+			return nil, fmt.Errorf("%s: host %d: invalid IP %q", name, i+1, h.IP)
+		}
+	}
+	return p, nil
+}
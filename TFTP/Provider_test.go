@@ -0,0 +1,160 @@
+package tftp
+
+import (
+	"errors"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"text/template"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerProvider(t *testing.T) {
+	root := fstest.MapFS{
+		"static.txt":           {Data: []byte("static")},
+		"pxelinux.cfg/default": {Data: []byte("default")},
+	}
+	var (
+		mu        sync.Mutex
+		requested []string
+	)
+	provider := ProviderFunc(func(name string, client net.Addr) ([]byte, error) {
+		mu.Lock()
+		requested = append(requested, name)
+		mu.Unlock()
+		switch name {
+		case "pxelinux.cfg/default":
+			return []byte("generated for " + client.(*net.UDPAddr).IP.String()), nil
+		case "broken":
+			return nil, errors.New("broken")
+		}
+		return nil, fs.ErrNotExist
+	})
+	addr := testServer(t, &Server{Root: root, Provider: provider, Timeout: time.Second})
+
+	// >> provided files are served in place of the root's
+	file, errPkt := readReq(t, addr, "/pxelinux.cfg/default")
+	require.Nil(t, errPkt)
+	require.Equal(t, "generated for 127.0.0.1", string(file))
+	mu.Lock()
+	require.Equal(t, []string{"pxelinux.cfg/default"}, requested)
+	mu.Unlock()
+
+	// >> others are read from the root
+	file, errPkt = readReq(t, addr, "static.txt")
+	require.Nil(t, errPkt)
+	require.Equal(t, "static", string(file))
+
+	// >> & failures other than not existing are reported
+	_, errPkt = readReq(t, addr, "broken")
+	require.NotNil(t, errPkt)
+	require.Equal(t, ErrUnknown, errPkt.Error)
+
+	// >> the size of provided files is known
+	conn, err := net.ListenPacket("udp", "127.0.0.1:")
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+	rrq, err := ReadReq{Filename: "pxelinux.cfg/default", Options: map[string]string{OptTransferSize: "0"}}.MarshalBinary()
+	require.NoError(t, err)
+	_, err = conn.WriteTo(rrq, addr)
+	require.NoError(t, err)
+
+	buf := make([]byte, DatagramSize)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	n, server, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	var oack OAck
+	require.NoError(t, oack.UnmarshalBinary(buf[:n]))
+	require.Equal(t, OAck{OptTransferSize: "23"}, oack)
+
+	abort, err := Err{Error: ErrUnknown, Message: "done"}.MarshalBinary()
+	require.NoError(t, err)
+	_, err = conn.WriteTo(abort, server)
+	require.NoError(t, err)
+}
+
+func TestTemplateProvider(t *testing.T) {
+	p := &TemplateProvider{
+		Files: map[string]*template.Template{
+			"pxelinux.cfg/01-*": template.Must(template.New("").Parse(
+				"{{.Host.Name}} {{.Host.Vars.role}} {{.Client}} {{.Filename}}")),
+		},
+		Hosts: []Host{
+			{Name: "node1", MAC: "52:54:00:12:34:56", IP: "10.0.0.11", Vars: map[string]string{"role": "worker"}},
+			{Name: "node2", MAC: "52:54:00:ab:cd:ef", IP: "10.0.0.12"},
+		},
+	}
+	client := &net.UDPAddr{IP: net.ParseIP("10.0.0.12"), Port: 2000}
+
+	// >> hosts are found by the MAC in the filename
+	data, err := p.Provide("pxelinux.cfg/01-52-54-00-12-34-56", client)
+	require.NoError(t, err)
+	require.Equal(t, "node1 worker 10.0.0.12 pxelinux.cfg/01-52-54-00-12-34-56", string(data))
+
+	// >> or else by the client's address
+	data, err = p.Provide("pxelinux.cfg/01-unknown", client)
+	require.NoError(t, err)
+	require.Equal(t, "node2 <no value> 10.0.0.12 pxelinux.cfg/01-unknown", string(data))
+
+	// >> files of unknown hosts & unmatched names aren't provided
+	_, err = p.Provide("pxelinux.cfg/01-52-54-00-00-00-00", &net.UDPAddr{IP: net.ParseIP("10.0.0.99")})
+	require.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = p.Provide("pxelinux.cfg/default", client)
+	require.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestLoadInventory(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		name = filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(name, []byte(data), 0644))
+		return name
+	}
+	write("pxelinux.tmpl", "LABEL {{.Host.Name}}\n  APPEND role={{.Host.Vars.role}}\n")
+	inventory := write("hosts.yaml", `
+files:
+  pxelinux.cfg/01-*: pxelinux.tmpl
+hosts:
+  - name: node1
+    mac: 52:54:00:12:34:56
+    ip: 10.0.0.11
+    vars: {role: worker}
+  - name: node2
+    mac: 52:54:00:ab:cd:ef
+`)
+	p, err := LoadInventory(inventory)
+	require.NoError(t, err)
+
+	// >> served by the server, with the root as fallback
+	root := fstest.MapFS{"pxelinux.cfg/default": {Data: []byte("default")}}
+	addr := testServer(t, &Server{Root: root, Provider: p, Timeout: time.Second})
+	file, errPkt := readReq(t, addr, "pxelinux.cfg/01-52-54-00-12-34-56")
+	require.Nil(t, errPkt)
+	require.Equal(t, "LABEL node1\n  APPEND role=worker\n", string(file))
+	file, errPkt = readReq(t, addr, "pxelinux.cfg/default")
+	require.Nil(t, errPkt)
+	require.Equal(t, "default", string(file))
+
+	// >> the template references a var node2 doesn't have
+	_, errPkt = readReq(t, addr, "pxelinux.cfg/01-52-54-00-ab-cd-ef")
+	require.NotNil(t, errPkt)
+	require.Equal(t, ErrUnknown, errPkt.Error)
+
+	// >> mistakes are reported on loading
+	for _, data := range []string{
+		"files: {'[': pxelinux.tmpl}",
+		"files: {x: missing.tmpl}",
+		"hosts: [{mac: nonsense}]",
+		"hosts: [{ip: 10.0.0}]",
+		"host: []",
+	} {
+		_, err := LoadInventory(write("bad.yaml", data))
+		require.Error(t, err, data)
+	}
+}
@@ -10,6 +10,7 @@ import (
 type ReadReq struct {
 	Filename string
 	Mode     string
+	Options  map[string]string // optional, such as OptBlockSize (RFC 2347)
 }
 
 // Although not used by our server, a client would make use of this method.
@@ -18,8 +19,14 @@ func (q ReadReq) MarshalBinary() ([]byte, error) {
 	if q.Mode != "" {
 		mode = q.Mode
 	}
+	if q.Filename == "" {
+		return nil, errors.New("invalid RRQ: empty filename")
+	}
+	if err := checkFields(q.Filename, mode); err != nil {
+		return nil, err
+	}
 	// operation code + filename + 0 byte + mode + 0 byte
-	cap := 2 + 2 + len(q.Filename) + 1 + len(q.Mode) + 1
+	cap := 2 + len(q.Filename) + 1 + len(mode) + 1
 	b := new(bytes.Buffer)
 	b.Grow(cap)
 	err := binary.Write(b, binary.BigEndian, OpRRQ) // write operation code
@@ -42,6 +49,10 @@ func (q ReadReq) MarshalBinary() ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	err = writeOptions(b, q.Options) // write options
+	if err != nil {
+		return nil, err
+	}
 	return b.Bytes(), nil
 }
 
@@ -78,9 +89,14 @@ func (q *ReadReq) UnmarshalBinary(p []byte) error {
 	if len(q.Mode) == 0 {
 		return errors.New("invalid RRQ")
 	}
-	actual := strings.ToLower(q.Mode) // > Ensuring Octet mode is selected
-	if actual != "octet" {
-		return errors.New("only binary transfers supported")
+	if !validMode(q.Mode) { // > Ensuring Octet or Netascii mode is selected
+		return errMode
+	}
+
+	// >> Reading Options
+	q.Options, err = readOptions(r)
+	if err != nil {
+		return errors.New("invalid RRQ")
 	}
 	return nil
 }
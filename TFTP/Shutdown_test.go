@@ -0,0 +1,145 @@
+package tftp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerShutdown(t *testing.T) {
+	file := bytes.Repeat([]byte("x"), 10*BlockSize)
+	s := &Server{Root: fstest.MapFS{"file.bin": {Data: file}}, Timeout: time.Second}
+	conn, err := net.ListenPacket("udp", "127.0.0.1:")
+	require.NoError(t, err)
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(conn) }()
+
+	// >> starting a transfer, and reading just the first block
+	c := Client{Timeout: time.Second, Retries: 1}
+	r, err := c.Get(context.Background(), conn.LocalAddr().String(), "file.bin")
+	require.NoError(t, err)
+	defer func() { _ = r.Close() }()
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- s.Shutdown(context.Background()) }()
+	require.ErrorIs(t, <-served, ErrServerClosed)
+
+	// >> no new transfers are accepted
+	_, err = c.Get(context.Background(), conn.LocalAddr().String(), "file.bin")
+	require.Error(t, err)
+	select {
+	case <-shutdown:
+		t.Fatal("shutdown returned before the transfer completed")
+	default:
+	}
+
+	// >> the transfer in progress completes
+	actual, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, file, actual)
+	require.NoError(t, <-shutdown)
+}
+
+func TestServerShutdownDally(t *testing.T) {
+	s := &Server{Root: fstest.MapFS{}, Uploads: DirSink(t.TempDir()), Timeout: time.Second}
+	addr := testServer(t, s)
+	conn, err := net.ListenPacket("udp", "127.0.0.1:")
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+
+	// >> the next packet from the server, if it sends one
+	buf := make([]byte, DatagramSize)
+	read := func(timeout time.Duration) (Packet, net.Addr, bool) {
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(timeout)))
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			return nil, nil, false
+		}
+		pkt, err := ParsePacket(buf[:n])
+		require.NoError(t, err)
+		return pkt, from, true
+	}
+
+	// >> uploading a single block file
+	wrq, err := WriteReq{Filename: "upload.txt"}.MarshalBinary()
+	require.NoError(t, err)
+	_, err = conn.WriteTo(wrq, addr)
+	require.NoError(t, err)
+	pkt, peer, ok := read(2 * time.Second)
+	require.True(t, ok)
+	require.Equal(t, Ack(0), *pkt.(*Ack))
+	dataPkt := Data{Payload: bytes.NewReader([]byte("upload"))}
+	final, err := dataPkt.MarshalBinary()
+	require.NoError(t, err)
+	_, err = conn.WriteTo(final, peer)
+	require.NoError(t, err)
+	pkt, _, ok = read(2 * time.Second)
+	require.True(t, ok)
+	require.Equal(t, Ack(1), *pkt.(*Ack))
+
+	// >> the server shuts down during the dally
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, s.Shutdown(ctx))
+
+	// >> the final block is acked again, or ignored, as if the ack was
+	// lost, but the client isn't told the upload failed
+	time.Sleep(100 * time.Millisecond)
+	_, err = conn.WriteTo(final, peer)
+	require.NoError(t, err)
+	for {
+		pkt, _, ok := read(500 * time.Millisecond)
+		if !ok {
+			break
+		}
+		require.IsType(t, new(Ack), pkt)
+		require.Equal(t, Ack(1), *pkt.(*Ack))
+	}
+}
+
+func TestServerShutdownTimeout(t *testing.T) {
+	file := bytes.Repeat([]byte("x"), 10*BlockSize)
+	s := &Server{Root: fstest.MapFS{"file.bin": {Data: file}}, Timeout: time.Second}
+	addr := testServer(t, s)
+
+	// >> a transfer that stalls after the first block
+	r, err := Client{Timeout: time.Second}.Get(context.Background(), addr.String(), "file.bin")
+	require.NoError(t, err)
+	defer func() { _ = r.Close() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, s.Shutdown(ctx), context.DeadlineExceeded)
+
+	// >> the client is told the transfer was cancelled
+	_, err = io.ReadAll(r)
+	var rErr *RemoteError
+	require.True(t, errors.As(err, &rErr), err)
+	require.Equal(t, "server shutting down", rErr.Message)
+}
+
+func TestServeContext(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- (&Server{Root: fstest.MapFS{}}).ServeContext(ctx, conn)
+	}()
+
+	cancel()
+	select {
+	case err := <-served:
+		require.ErrorIs(t, err, context.Canceled)
+	case <-time.After(time.Second):
+		t.Fatal("ServeContext didn't return")
+	}
+}
@@ -0,0 +1,51 @@
+package tftp
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+// ErrNoSpace can be returned by a Sink that has run out of room,
+// the client is then sent an ErrDiskFull error packet.
+var ErrNoSpace = errors.New("no space left")
+
+// >> Sink stores the files clients upload using write requests
+type Sink interface {
+	// Create opens a new file for writing.
+	// it must fail with fs.ErrExist if the file already exists
+	Create(filename string) (io.WriteCloser, error)
+
+	// Remove discards a file whose upload failed part way
+	Remove(filename string) error
+}
+
+// >> DirSink stores uploads in a directory on disk
+type DirSink string
+
+func (d DirSink) Create(filename string) (io.WriteCloser, error) {
+	name, err := d.path(filename)
+	if err != nil {
+		return nil, err
+	}
+	// O_EXCL so that uploads never overwrite an existing file
+	return os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+}
+
+func (d DirSink) Remove(filename string) error {
+	name, err := d.path(filename)
+	if err != nil {
+		return err
+	}
+	return os.Remove(name)
+}
+
+// >> the location of filename on disk
+// symlinks can't lead out of the directory, as with Dir
+func (d DirSink) path(filename string) (string, error) {
+	name, err := resolvePath(filename)
+	if err != nil {
+		return "", err
+	}
+	return inDir(string(d), name)
+}
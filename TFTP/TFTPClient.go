@@ -1 +1,555 @@
 package tftp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+var errRetries = errors.New("exhausted retries")
+
+// ErrTransferSize is returned when a download's size differs from the
+// transfer size the server announced, see Client.TransferSize.
+var ErrTransferSize = errors.New("transfer size mismatch")
+
+// Client downloads files from and uploads files to TFTP servers.
+// The zero value is ready to use.
+type Client struct {
+	Retries uint8         // the number of times to retry a failed transmission
+	Timeout time.Duration // the duration to wait for a reply
+	Mode    string        // ModeOctet (the default) or ModeNetASCII
+
+	// the block size to ask the server for, between MinBlockSize and
+	// MaxBlockSize. the default of BlockSize is used if 0 or refused
+	BlockSize int
+
+	// the number of blocks to send or receive before an ack (RFC 7440),
+	// up to MaxWindowSize. the default of 1 is used if 0 or refused
+	WindowSize int
+
+	// the block number that follows 65535, 0 or 1.
+	// 1 is negotiated with the server using OptRollover
+	Rollover uint16
+
+	// ask the server for the size of downloads (RFC 2349), and fail those
+	// that end short of it, such as when a server gives up part way
+	TransferSize bool
+
+	// opens the socket of each transfer, net.ListenPacket if nil
+	ListenPacket func(network, address string) (net.PacketConn, error)
+}
+
+// RemoteError is an error packet sent by the other side of a transfer.
+type RemoteError struct {
+	Code    ErrCode
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("remote error %d: %s", e.Code, e.Message)
+}
+
+// >> Get downloads filename from the server at addr
+// it returns once the first block arrives, so errors such as a missing file
+// are reported here. the rest of the file is received as it is read.
+// the transfer is aborted if ctx is done before it completes.
+func (c Client) Get(ctx context.Context, addr, filename string) (io.ReadCloser, error) {
+	if c.Mode != "" && !validMode(c.Mode) {
+		return nil, errMode
+	}
+	opts := c.options()
+	if c.TransferSize {
+		if opts == nil {
+			opts = make(map[string]string)
+		}
+		opts[OptTransferSize] = "0"
+	}
+	rrq, err := ReadReq{Filename: filename, Mode: c.Mode, Options: opts}.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	t, err := c.dial(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	t.options = opts
+
+	d := &download{transfer: t, last: rrq}
+	err = t.send(rrq)
+	if err == nil {
+		err = d.next()
+	}
+	if err != nil {
+		_ = t.close()
+		return nil, err
+	}
+	if isNetASCII(c.Mode) { // > line endings are translated on the way in
+		return newNetASCIIReader(d), nil
+	}
+	return d, nil
+}
+
+// >> Put uploads the contents of r to the server at addr as filename
+func (c Client) Put(ctx context.Context, addr, filename string, r io.Reader) error {
+	if c.Mode != "" && !validMode(c.Mode) {
+		return errMode
+	}
+	wrq, err := WriteReq{Filename: filename, Mode: c.Mode, Options: c.options()}.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	t, err := c.dial(ctx, addr)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = t.close() }()
+
+	if isNetASCII(c.Mode) { // > line endings are translated on the way out
+		r = newNetASCIIEncoder(r)
+	}
+
+	// >> the server acks the request with block 0 (or an OACK)
+	err = t.send(wrq)
+	if err == nil {
+		err = t.waitAck(wrq, 0)
+	}
+
+	// >> data packets are sent a window at a time, and the server acks the
+	// last one it received in order. the upload ends with a packet smaller
+	// than the datagram size, which is why an exact multiple ends with an
+	// empty block
+	var (
+		dataPkt = Data{Payload: r, Size: t.blockSize, Rollover: t.rollover}
+		window  [][]byte // data packets sent, but not yet acknowledged
+		final   = false
+	)
+	for err == nil {
+		for len(window) < t.windowSize && !final {
+			data, err := dataPkt.MarshalBinary()
+			if err != nil {
+				t.abort(Err{Error: ErrUnknown, Message: "unable to read file"})
+				return err
+			}
+			window = append(window, data)
+			final = len(data) < t.blockSize+4
+		}
+		if len(window) == 0 {
+			break // > everything was acknowledged
+		}
+
+		var acked int
+		acked, err = t.sendWindow(window)
+		window = window[acked:]
+	}
+	return err
+}
+
+// >> the options sent with requests
+func (c Client) options() map[string]string {
+	opts := make(map[string]string)
+	if c.BlockSize != 0 && c.BlockSize != BlockSize {
+		opts[OptBlockSize] = strconv.Itoa(c.BlockSize)
+	}
+	if c.WindowSize > 1 {
+		opts[OptWindowSize] = strconv.Itoa(c.WindowSize)
+	}
+	if c.Rollover == 1 {
+		opts[OptRollover] = "1"
+	}
+	if len(opts) == 0 {
+		return nil
+	}
+	return opts
+}
+
+// >> creates a socket for a single transfer with the server at addr
+func (c Client) dial(ctx context.Context, addr string) (*transfer, error) {
+	server, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	network := "udp6"
+	if server.IP.To4() != nil {
+		network = "udp4"
+	}
+	listen := c.ListenPacket
+	if listen == nil {
+		listen = net.ListenPacket
+	}
+	conn, err := listen(network, "")
+	if err != nil {
+		return nil, err
+	}
+
+	t := &transfer{
+		ctx:        ctx,
+		conn:       conn,
+		server:     server,
+		options:    c.options(),
+		size:       -1,
+		blockSize:  BlockSize,
+		windowSize: 1,
+		retries:    c.Retries,
+		timeout:    c.Timeout,
+		buf:        make([]byte, DatagramSize),
+		done:       make(chan struct{}),
+	}
+	if c.BlockSize > BlockSize {
+		t.buf = make([]byte, c.BlockSize+4)
+	}
+	if t.retries == 0 {
+		t.retries = 10
+	}
+	if t.timeout == 0 {
+		t.timeout = 6 * time.Second
+	}
+
+	// >> closing the socket interrupts any blocked read once ctx is done
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.Close()
+		case <-t.done:
+		}
+	}()
+	return t, nil
+}
+
+// >> the client side of a single transfer
+// the request is sent to the server's port, after which the server replies
+// from a new port (its transfer ID). only packets from that port are accepted
+type transfer struct {
+	ctx     context.Context
+	conn    net.PacketConn
+	server  *net.UDPAddr // where the request is sent
+	peer    net.Addr     // the server's transfer ID, nil until it replies
+	options map[string]string
+	retries uint8
+	timeout time.Duration
+	buf     []byte
+	done    chan struct{}
+
+	blockSize  int // as negotiated with the server
+	windowSize int
+	rollover   uint16
+	size       int64 // of the file, as told by the server, -1 if unknown
+}
+
+func (t *transfer) send(pkt []byte) error {
+	var addr net.Addr = t.server
+	if t.peer != nil {
+		addr = t.peer
+	}
+	_, err := t.conn.WriteTo(pkt, addr)
+	return t.wrap(err)
+}
+
+// >> reads the next packet from the server
+// packets from anyone else are answered with ErrUnknownID and ignored
+func (t *transfer) receive() ([]byte, error) {
+	_ = t.conn.SetReadDeadline(time.Now().Add(t.timeout))
+	for {
+		n, addr, err := t.conn.ReadFrom(t.buf)
+		if err != nil {
+			return nil, t.wrap(err)
+		}
+
+		if t.peer == nil && sameHost(addr, t.server) {
+			t.peer = addr // > the server's reply locks in its transfer ID
+		}
+		if t.peer == nil || addr.String() != t.peer.String() {
+			data, err := Err{Error: ErrUnknownID, Message: "unknown transfer ID"}.MarshalBinary()
+			if err == nil {
+				_, _ = t.conn.WriteTo(data, addr)
+			}
+			continue
+		}
+		return t.buf[:n], nil
+	}
+}
+
+// >> waits for the server to acknowledge block
+// last is the packet being acknowledged, and is resent on timeouts
+func (t *transfer) waitAck(last []byte, block uint16) error {
+	for i := t.retries; i > 0; {
+		pkt, err := t.receive()
+		if err != nil {
+			if nErr, ok := err.(net.Error); ok && nErr.Timeout() {
+				i--
+				if err = t.send(last); err != nil {
+					return err
+				}
+				continue
+			}
+			return err
+		}
+
+		p, _ := ParsePacket(pkt)
+		switch p := p.(type) {
+		case *Ack:
+			if uint16(*p) == block {
+				return nil
+			}
+			// > an ack for an earlier block is a duplicate, ignore it
+		case *OAck:
+			// > the server accepted options, in place of the first ack
+			if block == 0 {
+				return t.accept(*p)
+			}
+		case *Err:
+			return &RemoteError{Code: p.Error, Message: p.Message}
+		default: // > malformed, or an unknown opcode
+			t.abort(Err{Error: ErrIllegalOp, Message: "expected ACK"})
+			return errors.New("unexpected packet")
+		}
+	}
+	return errRetries
+}
+
+// >> applies the options the server accepted
+// the server may only accept options that were requested, and can't
+// raise the block size above what was asked for
+func (t *transfer) accept(oack OAck) error {
+	for name, value := range oack {
+		if _, ok := t.options[name]; !ok {
+			t.abort(Err{Error: ErrNegotiation, Message: "unrequested option " + name})
+			return fmt.Errorf("server accepted unrequested option %q", name)
+		}
+		if name == OptBlockSize {
+			size, err := strconv.Atoi(value)
+			if err != nil || size < MinBlockSize || size > len(t.buf)-4 {
+				t.abort(Err{Error: ErrNegotiation, Message: "invalid block size"})
+				return fmt.Errorf("server accepted invalid block size %q", value)
+			}
+			t.blockSize = size
+		}
+		if name == OptWindowSize {
+			size, err := strconv.Atoi(value)
+			requested, _ := strconv.Atoi(t.options[name])
+			if err != nil || size < 1 || size > requested {
+				t.abort(Err{Error: ErrNegotiation, Message: "invalid window size"})
+				return fmt.Errorf("server accepted invalid window size %q", value)
+			}
+			t.windowSize = size
+		}
+		if name == OptRollover {
+			if value != t.options[name] {
+				t.abort(Err{Error: ErrNegotiation, Message: "invalid rollover"})
+				return fmt.Errorf("server accepted invalid rollover %q", value)
+			}
+			t.rollover = 1
+		}
+		if name == OptTransferSize {
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || size < 0 {
+				t.abort(Err{Error: ErrNegotiation, Message: "invalid transfer size"})
+				return fmt.Errorf("server accepted invalid transfer size %q", value)
+			}
+			t.size = size
+		}
+	}
+	return nil
+}
+
+// >> sends a window of data packets, and waits for an ack of any of them
+// returns the number of packets at the start of the window that were acked,
+// the window is resent on timeouts
+func (t *transfer) sendWindow(window [][]byte) (int, error) {
+RETRY:
+	for i := t.retries; i > 0; i-- {
+		for _, data := range window {
+			if err := t.send(data); err != nil {
+				return 0, err
+			}
+		}
+
+		for {
+			pkt, err := t.receive()
+			if err != nil {
+				if nErr, ok := err.(net.Error); ok && nErr.Timeout() {
+					continue RETRY
+				}
+				return 0, err
+			}
+
+			p, _ := ParsePacket(pkt)
+			switch p := p.(type) {
+			case *Ack:
+				if acked := acknowledged(window, *p); acked > 0 {
+					return acked, nil
+				}
+				// > a duplicate ack of an earlier block, ignore it
+			case *OAck:
+				// > a duplicate of the OACK that accepted the request, ignore it
+			case *Err:
+				return 0, &RemoteError{Code: p.Error, Message: p.Message}
+			default: // > malformed, or an unknown opcode
+				t.abort(Err{Error: ErrIllegalOp, Message: "expected ACK"})
+				return 0, errors.New("unexpected packet")
+			}
+		}
+	}
+	return 0, errRetries
+}
+
+// >> tells the server the transfer is being abandoned
+func (t *transfer) abort(errPkt Err) {
+	if t.peer == nil {
+		return
+	}
+	data, err := errPkt.MarshalBinary()
+	if err == nil {
+		_, _ = t.conn.WriteTo(data, t.peer)
+	}
+}
+
+func (t *transfer) close() error {
+	select {
+	case <-t.done: // > already closed
+		return nil
+	default:
+	}
+	close(t.done)
+	return t.conn.Close()
+}
+
+// >> reports ctx's error if the failure was caused by ctx being done
+func (t *transfer) wrap(err error) error {
+	if err != nil && t.ctx.Err() != nil {
+		return t.ctx.Err()
+	}
+	return err
+}
+
+// >> a file being received, block by block, as it's read
+type download struct {
+	*transfer
+	last    []byte // the last packet sent, resent on timeouts
+	block   uint16 // the last block received in order
+	blocks  uint64 // the number of blocks received, which doesn't wrap
+	bytes   int64  // the number of bytes received
+	payload []byte // received but unread data
+	eof     bool   // the final block was received
+	err     error
+
+	received int  // blocks received since the last ack
+	nacked   bool // the server was told about a missing block
+}
+
+func (d *download) Read(p []byte) (int, error) {
+	for len(d.payload) == 0 {
+		if d.eof {
+			return 0, io.EOF
+		}
+		if d.err != nil {
+			return 0, d.err
+		}
+		d.err = d.next()
+	}
+	n := copy(p, d.payload)
+	d.payload = d.payload[n:]
+	return n, nil
+}
+
+// >> aborts the transfer if it hasn't completed
+func (d *download) Close() error {
+	if !d.eof && d.err == nil {
+		d.abort(Err{Error: ErrUnknown, Message: "transfer cancelled"})
+	}
+	return d.close()
+}
+
+// >> receives the next block
+// blocks are acknowledged a window at a time, with the last block
+// received in order
+func (d *download) next() error {
+	for i := d.retries; i > 0; {
+		pkt, err := d.receive()
+		if err != nil {
+			if nErr, ok := err.(net.Error); ok && nErr.Timeout() {
+				i--
+				d.received = 0 // > resending the ack restarts the window
+				if err = d.send(d.last); err != nil {
+					return err
+				}
+				continue
+			}
+			return err
+		}
+
+		p, _ := ParsePacket(pkt)
+		switch p := p.(type) {
+		case *Data:
+			dataPkt := p
+			if dataPkt.Block != nextBlock(d.block, d.rollover) {
+				// > a block out of order is either a retransmission of one
+				// we already have, or follows a lost block. either way the
+				// server is told where to continue from, once
+				if !d.nacked {
+					d.received, d.nacked = 0, true
+					if err = d.send(d.last); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			d.block, d.blocks = dataPkt.Block, d.blocks+1
+			d.bytes += int64(len(pkt) - 4)
+			d.payload = append([]byte(nil), pkt[4:]...) // pkt is reused
+			d.eof = len(pkt) < d.blockSize+4
+			d.received, d.nacked = d.received+1, false
+
+			d.last, err = Ack(d.block).MarshalBinary()
+			if err != nil {
+				return err
+			}
+			if d.eof || d.received == d.windowSize {
+				d.received = 0
+				if err = d.send(d.last); err != nil {
+					return err
+				}
+			}
+			if d.eof && d.size >= 0 && d.bytes != d.size {
+				// > the payload is still read, followed by the error
+				d.eof = false
+				return fmt.Errorf("%w: received %d of %d bytes", ErrTransferSize, d.bytes, d.size)
+			}
+			return nil
+		case *OAck:
+			if d.blocks > 0 {
+				continue // > a duplicate, once data is flowing. ignore it
+			}
+			// > the server accepted options, and waits for us to ack them
+			// with block 0 before sending any data
+			if err = d.accept(*p); err != nil {
+				return err
+			}
+			d.last, err = Ack(0).MarshalBinary()
+			if err != nil {
+				return err
+			}
+			if err = d.send(d.last); err != nil {
+				return err
+			}
+		case *Err:
+			return &RemoteError{Code: p.Error, Message: p.Message}
+		default: // > malformed, or an unknown opcode
+			d.abort(Err{Error: ErrIllegalOp, Message: "expected DATA"})
+			return errors.New("unexpected packet")
+		}
+	}
+	return errRetries
+}
+
+// >> reports whether addr is on the same host as server
+func sameHost(addr net.Addr, server *net.UDPAddr) bool {
+	udpAddr, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return false
+	}
+	return udpAddr.IP.Equal(server.IP) || server.IP.IsUnspecified()
+}
@@ -0,0 +1,165 @@
+package tftp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientGet(t *testing.T) {
+	large := bytes.Repeat([]byte("0123456789"), 200)
+	addr := testServer(t, &Server{
+		Root: fstest.MapFS{
+			"hello.txt": {Data: []byte("hello")},
+			"large.bin": {Data: large},
+		},
+		Timeout: time.Second,
+	})
+	c := Client{Timeout: time.Second}
+
+	for filename, expected := range map[string][]byte{
+		"hello.txt": []byte("hello"),
+		"large.bin": large,
+	} {
+		r, err := c.Get(context.Background(), addr.String(), filename)
+		require.NoError(t, err)
+		actual, err := io.ReadAll(r)
+		require.NoError(t, err)
+		require.NoError(t, r.Close())
+		require.Equal(t, expected, actual, filename)
+	}
+
+	// >> error packets are returned as a RemoteError
+	_, err := c.Get(context.Background(), addr.String(), "missing.txt")
+	var rErr *RemoteError
+	require.True(t, errors.As(err, &rErr))
+	require.Equal(t, ErrNotFound, rErr.Code)
+}
+
+func TestClientPut(t *testing.T) {
+	dir := t.TempDir()
+	addr := testServer(t, &Server{
+		Root:    fstest.MapFS{},
+		Uploads: DirSink(dir),
+		Timeout: time.Second,
+	})
+	c := Client{Timeout: time.Second}
+
+	expected := bytes.Repeat([]byte("backup"), 500)
+	err := c.Put(context.Background(), addr.String(), "backup.cfg", bytes.NewReader(expected))
+	require.NoError(t, err)
+	actual, err := os.ReadFile(filepath.Join(dir, "backup.cfg"))
+	require.NoError(t, err)
+	require.Equal(t, expected, actual)
+
+	err = c.Put(context.Background(), addr.String(), "backup.cfg", bytes.NewReader(expected))
+	var rErr *RemoteError
+	require.True(t, errors.As(err, &rErr))
+	require.Equal(t, ErrFileExists, rErr.Code)
+}
+
+func TestClientContext(t *testing.T) {
+	// >> nothing is listening, so the client waits until ctx is done
+	conn, err := net.ListenPacket("udp", "127.0.0.1:")
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = Client{Timeout: time.Minute}.Get(ctx, conn.LocalAddr().String(), "file")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), time.Minute)
+}
+
+func TestClientBlockSize(t *testing.T) {
+	dir := t.TempDir()
+	addr := testServer(t, &Server{
+		Root:         os.DirFS(dir),
+		Uploads:      DirSink(dir),
+		Timeout:      time.Second,
+		MaxBlockSize: 1024,
+	})
+
+	for _, size := range []int{MinBlockSize, 1000, 1024, 8192} {
+		c := Client{Timeout: time.Second, BlockSize: size}
+		filename := fmt.Sprintf("file-%d.bin", size)
+		expected := bytes.Repeat([]byte("0123456789"), 1024) // an exact multiple of 1024
+
+		err := c.Put(context.Background(), addr.String(), filename, bytes.NewReader(expected))
+		require.NoError(t, err)
+
+		r, err := c.Get(context.Background(), addr.String(), filename)
+		require.NoError(t, err)
+		actual, err := io.ReadAll(r)
+		require.NoError(t, err)
+		require.NoError(t, r.Close())
+		require.Equal(t, expected, actual)
+	}
+}
+
+func TestClientWindowSize(t *testing.T) {
+	dir := t.TempDir()
+	addr := testServer(t, &Server{
+		Root:    os.DirFS(dir),
+		Uploads: DirSink(dir),
+		Timeout: time.Second,
+	})
+
+	for _, size := range []int{2, 8, 64} { // > 64 is above the server's default limit
+		c := Client{Timeout: time.Second, BlockSize: 1024, WindowSize: size}
+		filename := fmt.Sprintf("file-%d.bin", size)
+		expected := bytes.Repeat([]byte("0123456789"), 10000)
+
+		err := c.Put(context.Background(), addr.String(), filename, bytes.NewReader(expected))
+		require.NoError(t, err)
+
+		r, err := c.Get(context.Background(), addr.String(), filename)
+		require.NoError(t, err)
+		actual, err := io.ReadAll(r)
+		require.NoError(t, err)
+		require.NoError(t, r.Close())
+		require.Equal(t, expected, actual)
+	}
+}
+
+func TestClientRollover(t *testing.T) {
+	dir := t.TempDir()
+	addr := testServer(t, &Server{
+		Root:    os.DirFS(dir),
+		Uploads: DirSink(dir),
+		Timeout: time.Second,
+	})
+	// > more than 65535 blocks of MinBlockSize, so block numbers wrap around
+	expected := bytes.Repeat([]byte("01234567"), 70000)
+
+	for _, rollover := range []uint16{0, 1} {
+		c := Client{
+			Timeout:    time.Second,
+			BlockSize:  MinBlockSize,
+			WindowSize: 16,
+			Rollover:   rollover,
+		}
+		filename := fmt.Sprintf("rollover-%d.bin", rollover)
+
+		err := c.Put(context.Background(), addr.String(), filename, bytes.NewReader(expected))
+		require.NoError(t, err)
+
+		r, err := c.Get(context.Background(), addr.String(), filename)
+		require.NoError(t, err)
+		actual, err := io.ReadAll(r)
+		require.NoError(t, err)
+		require.NoError(t, r.Close())
+		require.Equal(t, expected, actual)
+	}
+}
@@ -1,135 +1,816 @@
 package tftp
 
 import (
-	"bytes"
+	"context"
 	"errors"
-	"log"
+	"fmt"
+	"io"
+	"io/fs"
 	"net"
+	"path"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 )
 
+var errOutsideRoot = errors.New("path outside of root")
+
 type Server struct {
-	Payload []byte        // the payload served for all read requests
-	Retries uint8         // the number of times to retry a failed transmission
-	Timeout time.Duration // the duration to wait for an acknowledgment
+	Root     fs.FS         // the filesystem read requests are served from
+	Uploads  Sink          // where write requests are stored, writes are refused if nil
+	Provider Provider      // generates files served in place of the root's, if not nil
+	Retries  uint8         // the number of times to retry a failed transmission
+	Timeout  time.Duration // the duration to wait for an acknowledgment
+
+	// the largest block size clients can negotiate, MaxBlockSize if 0.
+	// blocks larger than the network's MTU get fragmented
+	MaxBlockSize int
+
+	// the largest window clients can negotiate, 16 if 0.
+	// each transfer buffers a window's worth of blocks
+	MaxWindowSize int
+
+	// the block number that follows 65535 in transfers of more than
+	// 65535 blocks, 0 or 1. clients can negotiate it with OptRollover
+	Rollover uint16
+
+	Logger   Logger   // where events are logged, the log package's default logger if nil
+	Observer Observer // notified of every transfer's events, such as a *Metrics
+
+	// >> access control, see ParseNetworks
+	Allow []*net.IPNet // only clients within these networks are served, unless empty
+	Deny  []*net.IPNet // clients within these networks are refused, even if allowed
+
+	MaxTransfers int // the most transfers in progress at once, unlimited if 0
+	MaxPerClient int // the most transfers in progress per client IP, unlimited if 0
+
+	// opens the sockets the server listens and transfers on,
+	// net.ListenPacket if nil. tests swap in a simulated network
+	ListenPacket func(network, address string) (net.PacketConn, error)
+
+	mu         sync.Mutex
+	listeners  map[net.PacketConn]struct{}
+	cancels    map[*context.CancelFunc]struct{} // cancel the transfers of each listener
+	transfers  sync.WaitGroup                   // transfers in progress
+	active     int                              // the number of transfers in progress
+	perClient  map[string]int                   // transfers in progress per client IP
+	files      map[string]*sharedFile           // files being read, by name
+	inShutdown bool
 }
 
-func (s Server) ListenAndServe(addr string) error {
-	conn, err := net.ListenPacket("udp", addr)
+func (s *Server) listenPacket(network, address string) (net.PacketConn, error) {
+	if s.ListenPacket != nil {
+		return s.ListenPacket(network, address)
+	}
+	return net.ListenPacket(network, address)
+}
+
+// ErrServerClosed is returned by Serve after a call to Shutdown.
+var ErrServerClosed = errors.New("server closed")
+
+// >> ListenAndServe listens on every address given, serving them all
+// IPv6 addresses, such as "[::]:69" or the link-local "[fe80::1%eth0]:69",
+// listen on udp6 only and IPv4 ones on udp4, so that both can be served at
+// once. a host name or an empty host, such as ":69", listens on both.
+// it returns once serving any of the addresses stops, which stops the others
+func (s *Server) ListenAndServe(addrs ...string) error {
+	if len(addrs) == 0 {
+		return errors.New("no address to listen on")
+	}
+	var conns []net.PacketConn
+	defer func() {
+		for _, conn := range conns {
+			_ = conn.Close()
+		}
+	}()
+	for _, addr := range addrs {
+		conn, err := s.listenPacket(listenNetwork(addr), addr)
+		if err != nil {
+			return err
+		}
+		conns = append(conns, conn)
+	}
+
+	errs := make(chan error, len(conns))
+	for _, conn := range conns {
+		s.logf("Listening on %s ...\n", conn.LocalAddr())
+		go func(conn net.PacketConn) { errs <- s.Serve(conn) }(conn)
+	}
+	err := <-errs
+	for _, conn := range conns {
+		_ = conn.Close()
+	}
+	for i := 1; i < len(conns); i++ {
+		<-errs
+	}
+	return err
+}
+
+// >> the network an address listens on, going by its IP
+func listenNetwork(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
 	if err != nil {
-		return err
+		return "udp"
+	}
+	if i := strings.LastIndexByte(host, '%'); i >= 0 { // > a zone
+		host = host[:i]
+	}
+	ip := net.ParseIP(host)
+	switch {
+	case ip == nil:
+		return "udp"
+	case ip.To4() != nil:
+		return "udp4"
+	default:
+		return "udp6"
 	}
-	defer func() { _ = conn.Close() }()
-	log.Printf("Listening on %s ...\n", conn.LocalAddr())
-	return s.Serve(conn)
 }
 
-// >> accepts the RRq and starts the process of sending data pkts
-// $$$ Feature: the payload should depend on the file requested.
+// Addrs returns the addresses the server is listening on, in no particular order.
+func (s *Server) Addrs() []net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	addrs := make([]net.Addr, 0, len(s.listeners))
+	for conn := range s.listeners {
+		addrs = append(addrs, conn.LocalAddr())
+	}
+	return addrs
+}
+
+// >> accepts RRQs & WRQs, and starts the process of sending/receiving data pkts
 func (s *Server) Serve(conn net.PacketConn) error {
+	return s.ServeContext(context.Background(), conn)
+}
+
+// >> ServeContext is Serve, until ctx is done
+// once ctx is done conn is closed, and the transfers started by this call
+// are cancelled. it returns ctx's error after they have stopped
+func (s *Server) ServeContext(ctx context.Context, conn net.PacketConn) error {
 	if conn == nil {
 		return errors.New("nil connection")
 	}
-	if s.Payload == nil {
-		return errors.New("payload is required")
+	if s.Root == nil {
+		return errors.New("root filesystem is required")
 	}
-	if s.Retries == 0 {
-		s.Retries = 10
-	}
-	if s.Timeout == 0 {
-		s.Timeout = 6 * time.Second
+
+	// >> the transfers get a context of their own, so that Shutdown can
+	// cancel them, and so that they outlive this call when conn fails
+	ctx, cancel := context.WithCancel(ctx)
+	if !s.track(conn, &cancel) {
+		cancel()
+		return ErrServerClosed
 	}
-	var rrq ReadReq
+	var (
+		transfers sync.WaitGroup
+		stop      = make(chan struct{})
+	)
+	defer func() {
+		close(stop)
+		s.untrack(conn, nil)
+		go func() {
+			transfers.Wait()
+			cancel()
+			s.untrack(nil, &cancel)
+		}()
+	}()
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.Close()
+		case <-stop:
+		}
+	}()
+
 	for {
 		buf := make([]byte, DatagramSize)
-		_, addr, err := conn.ReadFrom(buf)
+		n, addr, err := conn.ReadFrom(buf)
 		if err != nil {
+			switch {
+			case ctx.Err() != nil: // > cancelled, along with the transfers
+				transfers.Wait()
+				return ctx.Err()
+			case s.shuttingDown():
+				return ErrServerClosed
+			}
 			return err
 		}
-		err = rrq.UnmarshalBinary(buf)
-		if err != nil {
-			log.Printf("[%s] bad request: %v", addr, err)
+
+		pkt, err := ParsePacket(buf[:n])
+		if err == ErrUnknownOpcode {
+			s.logf("[%s] bad request: %v", addr, err)
+			s.refuse(conn, addr, illegalOp)
 			continue
 		}
-		// @ early return -> the entire payload is not sent
-		//
-		go s.handle(addr.String(), rrq)
+
+		var (
+			handle func()
+			linger func() // run once the transfer no longer counts, see dally
+			local  = conn.LocalAddr()
+		)
+		switch pkt := pkt.(type) {
+		case *ReadReq:
+			handle = func() { s.handle(ctx, local, addr, *pkt) }
+		case *WriteReq:
+			handle = func() { linger = s.handleWrite(ctx, local, addr, *pkt) }
+		case *Get:
+			handle = func() { s.handleList(ctx, local, addr, *pkt) }
+		default: // > malformed, or not a request
+			s.logf("[%s] bad request", addr)
+			continue
+		}
+
+		// >> access control & limits
+		// refused clients are told so from the listening port
+		var ip net.IP
+		if udpAddr, ok := addr.(*net.UDPAddr); ok {
+			ip = udpAddr.IP
+		}
+		if !s.allowed(ip) {
+			s.logf("[%s] denied", addr)
+			s.refuse(conn, addr, Err{Error: ErrAccessViolation, Message: "access denied"})
+			continue
+		}
+		ok, errPkt := s.startTransfer(ip.String())
+		if !ok {
+			if errPkt != nil {
+				s.logf("[%s] refused: %s", addr, errPkt.Message)
+				s.refuse(conn, addr, *errPkt)
+			}
+			continue
+		}
+		transfers.Add(1)
+		go func() {
+			handle()
+			transfers.Done()
+			s.endTransfer(ip.String())
+			if linger != nil {
+				linger()
+			}
+		}()
+	}
+}
+
+// >> Shutdown stops the server gracefully
+// the listening connections are closed, so no new transfers are accepted,
+// and then it waits for the transfers in progress to complete.
+// if ctx is done first, the remaining transfers are cancelled and
+// ctx's error is returned
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.inShutdown = true
+	for conn := range s.listeners {
+		_ = conn.Close()
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.transfers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		for cancel := range s.cancels {
+			(*cancel)()
+		}
+		s.mu.Unlock()
+		return ctx.Err()
 	}
 }
 
+// >> registers a listening connection & the cancel func of its transfers
+// returns false if the server is shutting down
+func (s *Server) track(conn net.PacketConn, cancel *context.CancelFunc) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.inShutdown {
+		return false
+	}
+	if s.listeners == nil {
+		s.listeners = make(map[net.PacketConn]struct{})
+		s.cancels = make(map[*context.CancelFunc]struct{})
+	}
+	s.listeners[conn] = struct{}{}
+	s.cancels[cancel] = struct{}{}
+	return true
+}
+
+func (s *Server) untrack(conn net.PacketConn, cancel *context.CancelFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.listeners, conn)
+	delete(s.cancels, cancel)
+}
+
+func (s *Server) shuttingDown() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.inShutdown
+}
+
+// >> aborts a transfer once ctx is done
+// the client is told why, and closing conn interrupts whatever
+// the transfer is waiting on. stop must be called once the transfer is over
+func abortOnDone(ctx context.Context, conn net.Conn) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			writeErr(conn, Err{Error: ErrUnknown, Message: "server shutting down"})
+			_ = conn.Close()
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
 // handle sending the data
-func (s Server) handle(clientAddr string, rrq ReadReq) {
-	log.Printf("[%s] requested file: %s", clientAddr, rrq.Filename)
+func (s *Server) handle(ctx context.Context, local, client net.Addr, rrq ReadReq) {
+	tl := s.begin(OpRRQ, client.String(), rrq.Filename)
+	defer tl.end()
 
 	// >> creating a client
 	// So that the server is not busy with communicating
 	// and so we can only recieve data from the client
-	conn, err := net.Dial("udp", clientAddr)
+	conn, err := s.listenPeer(local, client)
 	if err != nil {
-		log.Printf("[%s] dial: %v", clientAddr, err)
+		tl.fail("listen: %v", err)
 		return
 	}
 	defer func() { _ = conn.Close() }()
+	stop := abortOnDone(ctx, conn)
+	defer stop()
+
+	// >> opening the requested file
+	// on failure the client is told why, instead of being left to time out
+	r, size, release, err := s.openFile(rrq.Filename, client)
+	if err != nil {
+		tl.fail("reading %s: %v", rrq.Filename, err)
+		writeErr(conn, toErrPkt(err))
+		return
+	}
+	defer release()
+
+	if isNetASCII(rrq.Mode) { // > line endings are translated on the way out
+		// > the encoded size takes a pass over the file, so it's only
+		// counted when asked for, and is unknown if the file can't be reread
+		size = -1
+		if sr, ok := r.(*io.SectionReader); ok && rrq.Options[OptTransferSize] != "" {
+			size, err = netasciiSize(io.NewSectionReader(sr, 0, sr.Size()))
+			if err != nil {
+				tl.fail("reading %s: %v", rrq.Filename, err)
+				writeErr(conn, toErrPkt(err))
+				return
+			}
+		}
+		r = newNetASCIIEncoder(r)
+	}
+
+	// >> negotiating options
+	// the accepted ones are sent back in an OACK, which the client acks.
+	// the transfer size isn't one of them if it's unknown
+	opts := rrq.Options
+	if size < 0 {
+		opts = make(map[string]string, len(rrq.Options))
+		for name, value := range rrq.Options {
+			if name != OptTransferSize {
+				opts[name] = value
+			}
+		}
+	}
+	t, oack := s.negotiate(opts, size)
+	if oack != nil {
+		err = s.sendOAck(conn, oack, t, tl)
+		if err != nil {
+			tl.fail("negotiating options: %v", err)
+			return
+		}
+	}
+
+	s.send(ctx, conn, r, t, tl)
+}
+
+// >> sends r as data packets
+// until the final packet, smaller than the datagram size, is acked
+func (s *Server) send(ctx context.Context, conn net.Conn, r io.Reader, t settings, tl *transferLog) {
+	var ( // >> creating some variables
+		dataPkt = Data{Payload: r, Size: t.blockSize, Rollover: t.rollover}
+		buf     = make([]byte, t.datagramSize())
+		window  [][]byte // data packets sent, but not yet acknowledged
+		final   bool     // the final data packet has been created
+		blocks  uint64   // data packets created, which unlike block numbers doesn't wrap
+		last    Ack      // the last ack that moved the window, 0 acks the OACK
+		resent  bool     // the window was resent since, on a repeat of last
+	)
+
+	// creating the data packet responses
+	// they're sent a window at a time, and the client acks the last one
+	// it received in order. the acked packets leave the window, and what
+	// remains is resent along with new packets until the window is full again.
+	// the transfer ends once the final packet, smaller than the datagram size,
+	// is acked
+NEXTWINDOW:
+	for {
+		for len(window) < t.windowSize && !final {
+			data, err := dataPkt.MarshalBinary()
+			if err != nil {
+				tl.fail("preparing data packet: %v", err)
+				return
+			}
+			window = append(window, data)
+			final = len(data) < t.datagramSize()
+			blocks++
+			tl.add(len(data) - 4)
+			if dataPkt.Block == 0xffff {
+				tl.logf("block number rolling over after %d blocks (%d bytes)",
+					blocks, tl.event.Bytes)
+			}
+		}
+		if len(window) == 0 {
+			break // > everything was acknowledged
+		}
+
+		// trying to send the window
+	RETRY:
+		for i := t.retries; i > 0; i-- {
+			for _, data := range window {
+				_, err := conn.Write(data) // send the data packets
+				if err != nil {
+					tl.fail("write: %v", err)
+					return
+				}
+			}
+
+			// wait for the client's ACK packet
+			// packets that don't move the transfer along don't extend the wait
+			_ = conn.SetReadDeadline(time.Now().Add(t.timeout))
+			for {
+				n, err := conn.Read(buf) // reading ACK
+				if err != nil {
+					// if err is timeout
+					if nErr, ok := err.(net.Error); ok && nErr.Timeout() {
+						tl.retry(i)
+						continue RETRY
+					}
+					if ctx.Err() != nil {
+						tl.fail("transfer cancelled")
+						return
+					}
+					tl.fail("waiting for ACK: %v", err)
+					return
+				}
+
+				pkt, err := ParsePacket(buf[:n])
+				if err == ErrUnknownOpcode {
+					tl.fail("received an unknown opcode")
+					writeErr(conn, illegalOp)
+					return
+				}
+				switch pkt := pkt.(type) {
+				case *Ack: // > correct ack
+					ackPkt := *pkt
+					if acked := acknowledged(window, ackPkt); acked > 0 {
+						// received ACK; roll the window forward
+						window = window[acked:]
+						last, resent = ackPkt, false
+						continue NEXTWINDOW
+					}
+					// > an ack from before the window. with a window of
+					// several packets, a repeat of the last ack asks for the
+					// window to be resent, which is done once. anything else is
+					// a duplicate, resending on those would double every packet
+					// from then on (the Sorcerer's Apprentice, RFC 1123 4.2.3.1)
+					if t.windowSize > 1 && ackPkt == last && !resent {
+						resent = true
+						i++ // > not a timeout, so not a retry
+						continue RETRY
+					}
+				case *Err: // > err
+					tl.fail("received error: %v", pkt.Message)
+					return
+				default: // > malformed or unexpected, ignored
+					tl.logf("ignoring bad packet")
+				}
+			}
+		}
+		// >> at retry count too high
+		tl.fail("exhausted retries")
+		return
+	}
+	tl.complete(blocks)
+}
+
+// handle receiving an uploaded file
+// once the upload is complete, it returns the dally that follows it, to be
+// run once the transfer no longer counts towards the server's limits
+func (s *Server) handleWrite(ctx context.Context, local, client net.Addr, wrq WriteReq) (linger func()) {
+	tl := s.begin(OpWRQ, client.String(), wrq.Filename)
+	defer tl.end()
+
+	conn, err := s.listenPeer(local, client)
+	if err != nil {
+		tl.fail("listen: %v", err)
+		return nil
+	}
+	stop := abortOnDone(ctx, conn)
+	closeConn := func() {
+		stop()
+		_ = conn.Close()
+	}
+	defer func() {
+		if linger == nil { // > otherwise the dally closes it
+			closeConn()
+		}
+	}()
+
+	if s.Uploads == nil {
+		tl.fail("writes are not enabled")
+		writeErr(conn, Err{Error: ErrAccessViolation, Message: "writes not supported"})
+		return
+	}
+	w, err := s.Uploads.Create(wrq.Filename)
+	if err != nil {
+		tl.fail("creating %s: %v", wrq.Filename, err)
+		writeErr(conn, toErrPkt(err))
+		return
+	}
+	if isNetASCII(wrq.Mode) { // > line endings are translated on the way in
+		w = newNetASCIIWriter(w)
+	}
+
+	// >> negotiating options
+	// the accepted ones are sent back in an OACK, in place of the first ACK
+	t, oack := s.negotiate(wrq.Options, -1)
+	var oackData []byte
+	if oack != nil {
+		oackData, err = oack.MarshalBinary()
+		if err != nil {
+			tl.fail("preparing oack packet: %v", err)
+			return
+		}
+	}
+
+	// >> partial uploads are removed, so they can be retried later
+	complete := false
+	defer func() {
+		if !complete {
+			_ = w.Close()
+			_ = s.Uploads.Remove(wrq.Filename)
+		}
+	}()
 
 	var ( // >> creating some variables
-		ackPkt  Ack
-		errPkt  Err
-		dataPkt = Data{Payload: bytes.NewReader(s.Payload)}
-		buf     = make([]byte, DatagramSize)
+		ackPkt   Ack // the last block received in order, 0 accepts the request
+		buf      = make([]byte, t.datagramSize())
+		pending  = true  // ackPkt needs to be sent
+		received = 0     // blocks received since the last ack
+		nacked   = false // the client was told about a missing block
+		blocks   uint64  // blocks received in order, which unlike ackPkt doesn't wrap
 	)
 
-	// creating the data packet response
-	// the connection ends at n != DatagramSize
-	// since when that is the case we have reached the final packet
-NEXTPACKET:
-	// n declereation will only run once i think
-	// n gets updated with the size of the previous dataRq sent
-	for n := DatagramSize; n == DatagramSize; {
-		data, err := dataPkt.MarshalBinary()
+	// data packets are acknowledged a window at a time, with the last block
+	// received in order. the transfer ends with the first packet smaller than
+	// the datagram size
+	for i := t.retries; i > 0; {
+		if pending {
+			ack, err := ackPkt.MarshalBinary()
+			if err != nil {
+				tl.fail("preparing ack packet: %v", err)
+				return
+			}
+			if blocks == 0 && oackData != nil {
+				ack = oackData
+			}
+			_, err = conn.Write(ack) // send the ACK packet
+			if err != nil {
+				tl.fail("write: %v", err)
+				return
+			}
+			pending, received = false, 0
+		}
+
+		// wait for the next data packet
+		_ = conn.SetReadDeadline(time.Now().Add(t.timeout))
+		n, err := conn.Read(buf)
 		if err != nil {
-			log.Printf("[%s] preparing data packet: %v", clientAddr, err)
+			if nErr, ok := err.(net.Error); ok && nErr.Timeout() {
+				tl.retry(i)
+				i--
+				pending = true // > resending the ack restarts the window
+				continue
+			}
+			if ctx.Err() != nil {
+				tl.fail("transfer cancelled")
+				return
+			}
+			tl.fail("waiting for DATA: %v", err)
 			return
 		}
-		// trying to send the packet
-	RETRY:
-		for i := s.Retries; i > 0; i-- {
-			n, err = conn.Write(data) // send the data packet
+
+		pkt, err := ParsePacket(buf[:n])
+		if err == ErrUnknownOpcode {
+			tl.fail("received an unknown opcode")
+			writeErr(conn, illegalOp)
+			return
+		}
+		switch pkt := pkt.(type) {
+		case *Data:
+			dataPkt := pkt
+			// > a block out of order is either a retransmission of one we
+			// already have, or follows a lost block. either way the client
+			// is told where to continue from, once
+			if dataPkt.Block != nextBlock(uint16(ackPkt), t.rollover) {
+				if !nacked {
+					pending, nacked = true, true
+				}
+				continue
+			}
+
+			_, err = io.Copy(w, dataPkt.Payload)
 			if err != nil {
-				log.Printf("[%s] write: %v", clientAddr, err)
+				tl.fail("writing %s: %v", wrq.Filename, err)
+				writeErr(conn, toErrPkt(err))
 				return
 			}
+			ackPkt = Ack(dataPkt.Block)
+			i, received, nacked = t.retries, received+1, false
+			blocks++
+			tl.add(n - 4)
 
-			// wait for the client's ACK packet
-			_ = conn.SetReadDeadline(time.Now().Add(s.Timeout))
-			_, err = conn.Read(buf) // reading ACK
+			if n < t.datagramSize() { // > final packet
+				err = w.Close()
+				complete = err == nil
+				if err != nil {
+					tl.fail("closing %s: %v", wrq.Filename, err)
+					writeErr(conn, toErrPkt(err))
+					return
+				}
+				tl.complete(blocks)
+
+				// >> the upload succeeded, so the client mustn't be told
+				// it was aborted, even if the dally is cut short
+				stop()
+				final := ackPkt
+				return func() {
+					defer func() { _ = conn.Close() }()
+					s.dally(ctx, conn, final, t)
+				}
+			}
+			pending = received == t.windowSize
+		case *Err: // > err
+			tl.fail("received error: %v", pkt.Message)
+			return
+		default: // > malformed or unexpected, ignored
+			tl.logf("ignoring bad packet")
+		}
+	}
+	// >> at retry count too high
+	tl.fail("exhausted retries")
+	return nil
+}
+
+// >> acknowledges the final data packet
+// and keeps re-acknowledging it for a while, in case that ack gets lost
+// and the client retransmits the final packet. the client only does so
+// after its own timeout, so it's given a few of those. other packets,
+// such as late duplicates of earlier blocks, are ignored. the upload is
+// already over by then, so this doesn't count towards the server's limits,
+// and it stops early, silently, if the transfer's context is done
+func (s *Server) dally(ctx context.Context, conn net.Conn, final Ack, t settings) {
+	ack, err := final.MarshalBinary()
+	if err != nil {
+		return
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.Close() // > interrupts the read below
+		case <-done:
+		}
+	}()
+
+	buf := make([]byte, t.datagramSize())
+	for {
+		_, err = conn.Write(ack)
+		if err != nil {
+			return
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(3 * t.timeout))
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return // > timeout, the client got our ack
+			}
+			pkt, _ := ParsePacket(buf[:n])
+			if dataPkt, ok := pkt.(*Data); ok && dataPkt.Block == uint16(final) {
+				break
+			}
+		}
+	}
+}
+
+// >> sends the accepted options, and waits for the client to ack them
+// with block 0. the client may instead refuse them with an error packet
+func (s *Server) sendOAck(conn net.Conn, oack OAck, t settings, tl *transferLog) error {
+	data, err := oack.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, t.datagramSize())
+RETRY:
+	for i := t.retries; i > 0; i-- {
+		_, err = conn.Write(data)
+		if err != nil {
+			return err
+		}
+
+		_ = conn.SetReadDeadline(time.Now().Add(t.timeout))
+		for {
+			n, err := conn.Read(buf)
 			if err != nil {
-				// if err is timeout
 				if nErr, ok := err.(net.Error); ok && nErr.Timeout() {
-					log.Println("Testing")
+					tl.retry(i)
 					continue RETRY
 				}
-				log.Printf("[%s] waiting for ACK: %v", clientAddr, err)
-				return
+				return err
 			}
 
-			switch {
-			case ackPkt.UnmarshalBinary(buf) == nil: // > correct ack
-				if uint16(ackPkt) == dataPkt.Block {
-					// received ACK; send next data packet
-					continue NEXTPACKET
+			pkt, err := ParsePacket(buf[:n])
+			if err == ErrUnknownOpcode {
+				writeErr(conn, illegalOp)
+				return err
+			}
+			switch pkt := pkt.(type) {
+			case *Ack:
+				if *pkt == 0 {
+					return nil
 				}
-			case errPkt.UnmarshalBinary(buf) == nil: // > err
-				log.Printf("[%s] received error: %v",
-					clientAddr, errPkt.Message)
-				return
-			default: // > unknown
-				log.Printf("[%s] bad packet", clientAddr)
-				return
+			case *Err:
+				return fmt.Errorf("received error: %s", pkt.Message)
+			default: // > malformed or unexpected, ignored like stray acks
+				tl.logf("ignoring bad packet")
 			}
 		}
-		// >> at retry count too high
-		log.Printf("[%s] exhausted retries", clientAddr)
+	}
+	return errRetries
+}
+
+// >> answers a request that won't be served with an error packet
+func (s *Server) refuse(conn net.PacketConn, addr net.Addr, errPkt Err) {
+	data, err := errPkt.MarshalBinary()
+	if err != nil {
 		return
 	}
-	log.Printf("[%s] sent %d blocks", clientAddr, dataPkt.Block)
+	_, _ = conn.WriteTo(data, addr)
+}
+
+// >> sends an error packet, the transfer is over after this
+func writeErr(conn net.Conn, errPkt Err) {
+	data, err := errPkt.MarshalBinary()
+	if err != nil {
+		return
+	}
+	_, _ = conn.Write(data)
+}
+
+// >> converts a requested filename into a path within the root
+// clients commonly prefix filenames with a slash, which is dropped.
+// anything that would climb out of the root (e.g. "../") is rejected
+func resolvePath(filename string) (string, error) {
+	name := strings.TrimLeft(filename, "/")
+	for _, elem := range strings.Split(name, "/") {
+		if elem == ".." {
+			return "", errOutsideRoot
+		}
+	}
+
+	name = path.Clean(name)
+	if name == "." || !fs.ValidPath(name) {
+		return "", errOutsideRoot
+	}
+	return name, nil
+}
+
+// >> maps errors from reading or writing a file to the error packet sent to the client
+func toErrPkt(err error) Err {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return Err{Error: ErrNotFound, Message: "file not found"}
+	case errors.Is(err, fs.ErrExist):
+		return Err{Error: ErrFileExists, Message: "file already exists"}
+	case errors.Is(err, ErrNoSpace), errors.Is(err, syscall.ENOSPC):
+		return Err{Error: ErrDiskFull, Message: "disk full or allocation exceeded"}
+	case errors.Is(err, errOutsideRoot), errors.Is(err, fs.ErrPermission):
+		return Err{Error: ErrAccessViolation, Message: "access violation"}
+	default:
+		return Err{Error: ErrUnknown, Message: "unable to access file"}
+	}
 }
@@ -0,0 +1,345 @@
+package tftp
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// >> starts a server on a random loopback port serving root
+func testServer(t *testing.T, s *Server) net.Addr {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	go func() { _ = s.Serve(conn) }()
+	return conn.LocalAddr()
+}
+
+// >> requests filename from the server & acks every data packet
+// returns the received file, or the error packet the server replied with
+func readReq(t *testing.T, server net.Addr, filename string) ([]byte, *Err) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:")
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+
+	rrq, err := ReadReq{Filename: filename}.MarshalBinary()
+	require.NoError(t, err)
+	_, err = conn.WriteTo(rrq, server)
+	require.NoError(t, err)
+
+	var (
+		file = new(bytes.Buffer)
+		buf  = make([]byte, DatagramSize)
+	)
+	for {
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+		n, addr, err := conn.ReadFrom(buf)
+		require.NoError(t, err)
+
+		var errPkt Err
+		if errPkt.UnmarshalBinary(buf[:n]) == nil {
+			return nil, &errPkt
+		}
+
+		var dataPkt Data
+		require.NoError(t, dataPkt.UnmarshalBinary(buf[:n]))
+		_, err = io.Copy(file, dataPkt.Payload)
+		require.NoError(t, err)
+
+		ack, err := Ack(dataPkt.Block).MarshalBinary()
+		require.NoError(t, err)
+		_, err = conn.WriteTo(ack, addr)
+		require.NoError(t, err)
+
+		if n < DatagramSize {
+			return file.Bytes(), nil
+		}
+	}
+}
+
+func TestServerRoot(t *testing.T) {
+	large := bytes.Repeat([]byte("0123456789"), 200) // spans several blocks
+	root := fstest.MapFS{
+		"hello.txt":        {Data: []byte("hello")},
+		"images/large.bin": {Data: large},
+		"empty":            {Data: []byte{}},
+	}
+	addr := testServer(t, &Server{Root: root, Timeout: time.Second})
+
+	for filename, expected := range map[string][]byte{
+		"hello.txt":         []byte("hello"),
+		"/hello.txt":        []byte("hello"),
+		"images/large.bin":  large,
+		"images//large.bin": large,
+		"empty":             {},
+	} {
+		actual, errPkt := readReq(t, addr, filename)
+		require.Nil(t, errPkt, filename)
+		require.Equal(t, string(expected), string(actual), filename)
+	}
+
+	for filename, code := range map[string]ErrCode{
+		"missing.txt":            ErrNotFound,
+		"images":                 ErrNotFound,
+		"../hello.txt":           ErrAccessViolation,
+		"images/../../hello.txt": ErrAccessViolation,
+		"/":                      ErrAccessViolation,
+	} {
+		_, errPkt := readReq(t, addr, filename)
+		require.NotNil(t, errPkt, filename)
+		require.Equal(t, code, errPkt.Error, filename)
+	}
+}
+
+func TestServerRequiresRoot(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:")
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+
+	require.Error(t, new(Server).Serve(conn))
+}
+
+// >> uploads file to the server, sending each block once it's acked
+// returns the error packet the server replied with, if any
+func writeReq(t *testing.T, server net.Addr, filename string, file []byte) *Err {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:")
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+
+	wrq, err := WriteReq{Filename: filename}.MarshalBinary()
+	require.NoError(t, err)
+	_, err = conn.WriteTo(wrq, server)
+	require.NoError(t, err)
+
+	var (
+		dataPkt = Data{Payload: bytes.NewReader(file)}
+		buf     = make([]byte, DatagramSize)
+		last    = false
+	)
+	for {
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+		n, addr, err := conn.ReadFrom(buf)
+		require.NoError(t, err)
+
+		var errPkt Err
+		if errPkt.UnmarshalBinary(buf[:n]) == nil {
+			return &errPkt
+		}
+
+		var ackPkt Ack
+		require.NoError(t, ackPkt.UnmarshalBinary(buf[:n]))
+		require.Equal(t, dataPkt.Block, uint16(ackPkt))
+		if last {
+			return nil
+		}
+
+		data, err := dataPkt.MarshalBinary()
+		require.NoError(t, err)
+		_, err = conn.WriteTo(data, addr)
+		require.NoError(t, err)
+		last = len(data) < DatagramSize
+	}
+}
+
+// >> a sink that runs out of space after limit bytes
+type fullSink struct {
+	limit   int
+	removed chan string
+}
+
+func (f *fullSink) Create(string) (io.WriteCloser, error) { return f, nil }
+func (f *fullSink) Remove(filename string) error {
+	f.removed <- filename
+	return nil
+}
+func (f *fullSink) Close() error { return nil }
+func (f *fullSink) Write(p []byte) (int, error) {
+	if len(p) > f.limit {
+		return 0, ErrNoSpace
+	}
+	f.limit -= len(p)
+	return len(p), nil
+}
+
+func TestServerWrite(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "exists.txt"), nil, 0644))
+	addr := testServer(t, &Server{
+		Root:    fstest.MapFS{},
+		Uploads: DirSink(dir),
+		Timeout: time.Second,
+	})
+
+	for filename, expected := range map[string][]byte{
+		"small.txt": []byte("config backup"),
+		"large.bin": bytes.Repeat([]byte("0123456789"), 200),
+		"exact.bin": bytes.Repeat([]byte("x"), BlockSize), // ends in an empty block
+		"empty":     {},
+	} {
+		require.Nil(t, writeReq(t, addr, filename, expected), filename)
+		actual, err := os.ReadFile(filepath.Join(dir, filename))
+		require.NoError(t, err)
+		require.Equal(t, string(expected), string(actual), filename)
+	}
+
+	errPkt := writeReq(t, addr, "exists.txt", []byte("overwrite"))
+	require.NotNil(t, errPkt)
+	require.Equal(t, ErrFileExists, errPkt.Error)
+
+	errPkt = writeReq(t, addr, "../escape.txt", []byte("escape"))
+	require.NotNil(t, errPkt)
+	require.Equal(t, ErrAccessViolation, errPkt.Error)
+}
+
+// >> the server dallies after the final ack of an upload, but that
+// doesn't count as a transfer, so neither the client's next upload
+// nor a shutdown wait for it
+func TestServerWriteDally(t *testing.T) {
+	s := &Server{
+		Root:         fstest.MapFS{},
+		Uploads:      DirSink(t.TempDir()),
+		Timeout:      time.Second,
+		MaxPerClient: 1,
+	}
+	addr := testServer(t, s)
+	c := Client{Timeout: time.Second, Retries: 1}
+
+	file := bytes.Repeat([]byte("x"), 3*BlockSize)
+	require.NoError(t, c.Put(context.Background(), addr.String(), "first.bin", bytes.NewReader(file)))
+	require.NoError(t, c.Put(context.Background(), addr.String(), "second.bin", bytes.NewReader(file)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, s.Shutdown(ctx))
+}
+
+func TestServerWriteErrors(t *testing.T) {
+	// >> writes are refused without a sink
+	addr := testServer(t, &Server{Root: fstest.MapFS{}, Timeout: time.Second})
+	errPkt := writeReq(t, addr, "file.txt", []byte("data"))
+	require.NotNil(t, errPkt)
+	require.Equal(t, ErrAccessViolation, errPkt.Error)
+
+	// >> a full sink discards the partial upload
+	sink := &fullSink{limit: BlockSize, removed: make(chan string, 1)}
+	addr = testServer(t, &Server{Root: fstest.MapFS{}, Uploads: sink, Timeout: time.Second})
+	errPkt = writeReq(t, addr, "file.txt", bytes.Repeat([]byte("x"), 2*BlockSize))
+	require.NotNil(t, errPkt)
+	require.Equal(t, ErrDiskFull, errPkt.Error)
+	select {
+	case filename := <-sink.removed:
+		require.Equal(t, "file.txt", filename)
+	case <-time.After(time.Second):
+		t.Fatal("partial upload was not removed")
+	}
+}
+
+func TestServerOptions(t *testing.T) {
+	large := bytes.Repeat([]byte("0123456789"), 1000)
+	addr := testServer(t, &Server{
+		Root:         fstest.MapFS{"large.bin": {Data: large}},
+		Timeout:      time.Second,
+		MaxBlockSize: 4096,
+	})
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:")
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+
+	rrq, err := ReadReq{Filename: "large.bin", Options: map[string]string{
+		OptBlockSize:    "8192", // > above the server's limit
+		OptTimeout:      "2",
+		OptTransferSize: "0",
+		"unknown":       "1", // > ignored
+	}}.MarshalBinary()
+	require.NoError(t, err)
+	_, err = conn.WriteTo(rrq, addr)
+	require.NoError(t, err)
+
+	// >> the server replies with the options it accepted
+	buf := make([]byte, 8192+4)
+	n, server, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	var oack OAck
+	require.NoError(t, oack.UnmarshalBinary(buf[:n]))
+	require.Equal(t, OAck{
+		OptBlockSize:    "4096",
+		OptTimeout:      "2",
+		OptTransferSize: "10000",
+	}, oack)
+
+	// >> the data follows once the OACK is acked with block 0
+	ack, err := Ack(0).MarshalBinary()
+	require.NoError(t, err)
+	_, err = conn.WriteTo(ack, server)
+	require.NoError(t, err)
+
+	n, _, err = conn.ReadFrom(buf)
+	require.NoError(t, err)
+	var dataPkt Data
+	require.NoError(t, dataPkt.UnmarshalBinary(buf[:n]))
+	require.Equal(t, uint16(1), dataPkt.Block)
+	require.Equal(t, 4096+4, n)
+}
+
+func TestServerWindowSize(t *testing.T) {
+	file := bytes.Repeat([]byte("x"), 10*BlockSize+1) // 11 blocks
+	addr := testServer(t, &Server{
+		Root:    fstest.MapFS{"file.bin": {Data: file}},
+		Timeout: time.Second,
+	})
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:")
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+
+	rrq, err := ReadReq{Filename: "file.bin", Options: map[string]string{
+		OptWindowSize: "4",
+	}}.MarshalBinary()
+	require.NoError(t, err)
+	_, err = conn.WriteTo(rrq, addr)
+	require.NoError(t, err)
+
+	buf := make([]byte, DatagramSize)
+	n, server, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	var oack OAck
+	require.NoError(t, oack.UnmarshalBinary(buf[:n]))
+	require.Equal(t, OAck{OptWindowSize: "4"}, oack)
+
+	// >> acks block, and returns the blocks the server sends next
+	ackWindow := func(block uint16, count int) []uint16 {
+		ack, err := Ack(block).MarshalBinary()
+		require.NoError(t, err)
+		_, err = conn.WriteTo(ack, server)
+		require.NoError(t, err)
+
+		var blocks []uint16
+		for i := 0; i < count; i++ {
+			n, _, err := conn.ReadFrom(buf)
+			require.NoError(t, err)
+			var dataPkt Data
+			require.NoError(t, dataPkt.UnmarshalBinary(buf[:n]))
+			blocks = append(blocks, dataPkt.Block)
+		}
+		return blocks
+	}
+
+	require.Equal(t, []uint16{1, 2, 3, 4}, ackWindow(0, 4))
+	// > block 3 "got lost", so the server rolls back to it
+	require.Equal(t, []uint16{3, 4, 5, 6}, ackWindow(2, 4))
+	require.Equal(t, []uint16{7, 8, 9, 10}, ackWindow(6, 4))
+	require.Equal(t, []uint16{11}, ackWindow(10, 1))
+}
@@ -0,0 +1,17 @@
+package tftp
+
+import "encoding/binary"
+
+// >> the number of packets at the start of window that are acknowledged by ack
+// with the windowsize option (RFC 7440), the receiver acks the last packet
+// it got in order, the packets after it have to be resent.
+// returns 0 when the ack isn't for any packet in the window, such as a
+// duplicate ack of a packet that was acknowledged earlier
+func acknowledged(window [][]byte, ack Ack) int {
+	for i, data := range window {
+		if binary.BigEndian.Uint16(data[2:4]) == uint16(ack) {
+			return i + 1
+		}
+	}
+	return 0
+}
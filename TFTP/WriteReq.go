@@ -0,0 +1,102 @@
+package tftp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+// >> write request
+// has the same layout as a read request, with a different operation code
+type WriteReq struct {
+	Filename string
+	Mode     string
+	Options  map[string]string // optional, such as OptBlockSize (RFC 2347)
+}
+
+func (q WriteReq) MarshalBinary() ([]byte, error) {
+	mode := "octet"
+	if q.Mode != "" {
+		mode = q.Mode
+	}
+	if q.Filename == "" {
+		return nil, errors.New("invalid WRQ: empty filename")
+	}
+	if err := checkFields(q.Filename, mode); err != nil {
+		return nil, err
+	}
+	// operation code + filename + 0 byte + mode + 0 byte
+	cap := 2 + len(q.Filename) + 1 + len(mode) + 1
+	b := new(bytes.Buffer)
+	b.Grow(cap)
+	err := binary.Write(b, binary.BigEndian, OpWRQ) // write operation code
+	if err != nil {
+		return nil, err
+	}
+	_, err = b.WriteString(q.Filename) // write filename
+	if err != nil {
+		return nil, err
+	}
+	err = b.WriteByte(0) // write 0 byte
+	if err != nil {
+		return nil, err
+	}
+	_, err = b.WriteString(mode) // write mode
+	if err != nil {
+		return nil, err
+	}
+	err = b.WriteByte(0) // write 0 byte
+	if err != nil {
+		return nil, err
+	}
+	err = writeOptions(b, q.Options) // write options
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (q *WriteReq) UnmarshalBinary(p []byte) error {
+	r := bytes.NewBuffer(p)
+
+	// >> Reading OpCode
+	var code OpCode
+	err := binary.Read(r, binary.BigEndian, &code)
+	if err != nil {
+		return err
+	}
+	if code != OpWRQ {
+		return errors.New("invalid WRQ")
+	}
+
+	// >> Reading Filename
+	q.Filename, err = r.ReadString(0)
+	if err != nil {
+		return errors.New("invalid WRQ")
+	}
+	q.Filename = strings.TrimRight(q.Filename, "\x00") // remove the 0-byte
+	if len(q.Filename) == 0 {
+		return errors.New("invalid WRQ")
+	}
+
+	// >> Reading Mode
+	q.Mode, err = r.ReadString(0)
+	if err != nil {
+		return errors.New("invalid WRQ")
+	}
+	q.Mode = strings.TrimRight(q.Mode, "\x00") // remove the 0-byte
+	if len(q.Mode) == 0 {
+		return errors.New("invalid WRQ")
+	}
+	if !validMode(q.Mode) { // > Ensuring Octet or Netascii mode is selected
+		return errMode
+	}
+
+	// >> Reading Options
+	q.Options, err = readOptions(r)
+	if err != nil {
+		return errors.New("invalid WRQ")
+	}
+	return nil
+}
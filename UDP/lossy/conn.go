@@ -0,0 +1,37 @@
+package lossy
+
+import (
+	"net"
+	"sync/atomic"
+)
+
+// >> a net.PacketConn whose outgoing packets go through faults
+type conn struct {
+	net.PacketConn
+	faults *faults
+	closed int32
+}
+
+// Wrap returns a net.PacketConn that injects the faults described by config
+// into the packets written to pc. packets read from pc are passed through,
+// wrap both ends for faults in both directions
+func Wrap(pc net.PacketConn, config Config) net.PacketConn {
+	return &conn{PacketConn: pc, faults: newFaults(config)}
+}
+
+// WriteTo reports every packet as written, whatever happens to it,
+// the same as a packet lost on the network
+func (c *conn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	if atomic.LoadInt32(&c.closed) != 0 {
+		return 0, net.ErrClosed
+	}
+	c.faults.apply(p, func(packet []byte) {
+		_, _ = c.PacketConn.WriteTo(packet, addr)
+	})
+	return len(p), nil
+}
+
+func (c *conn) Close() error {
+	atomic.StoreInt32(&c.closed, 1)
+	return c.PacketConn.Close()
+}
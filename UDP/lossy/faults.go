@@ -0,0 +1,89 @@
+// Package lossy simulates an unreliable network for testing UDP protocols.
+// packets can be lost, duplicated, reordered, delayed and corrupted, using a
+// seeded random source so that a failing test can be replayed.
+package lossy
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// DefaultReorderDelay is how long a reordered packet is held back,
+// if Config.ReorderDelay is 0.
+const DefaultReorderDelay = 20 * time.Millisecond
+
+// Config describes the faults injected into the packets sent.
+// the probabilities are between 0 (never) and 1 (always)
+type Config struct {
+	Seed int64 // seeds the random source, the same seed makes the same choices
+
+	Loss      float64 // the probability a packet is dropped
+	Duplicate float64 // the probability a packet is delivered twice
+	Reorder   float64 // the probability a packet is held back, letting later ones overtake it
+	Corrupt   float64 // the probability a bit is flipped in a packet
+
+	Delay        time.Duration // added to every packet
+	Jitter       time.Duration // a random delay up to Jitter is added on top of Delay
+	ReorderDelay time.Duration // how long reordered packets are held back, DefaultReorderDelay if 0
+}
+
+// >> decides the fate of each packet sent
+// the choices are made in the order packets are sent, under the lock,
+// so that a seed makes the same choices for the same traffic
+type faults struct {
+	mu     sync.Mutex
+	config Config
+	rand   *rand.Rand
+}
+
+func newFaults(config Config) *faults {
+	return &faults{config: config, rand: rand.New(rand.NewSource(config.Seed))}
+}
+
+func (f *faults) set(config Config) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.config = config
+	f.rand = rand.New(rand.NewSource(config.Seed))
+}
+
+// >> delivers a copy of p, zero or more times and possibly later
+// p itself isn't kept, the caller may reuse it
+func (f *faults) apply(p []byte, deliver func([]byte)) {
+	f.mu.Lock()
+	c := f.config
+	if f.rand.Float64() < c.Loss {
+		f.mu.Unlock()
+		return
+	}
+
+	packet := append([]byte(nil), p...)
+	if len(packet) > 0 && f.rand.Float64() < c.Corrupt {
+		bit := f.rand.Intn(8 * len(packet))
+		packet[bit/8] ^= 1 << (bit % 8)
+	}
+	copies := 1
+	if f.rand.Float64() < c.Duplicate {
+		copies = 2
+	}
+	delay := c.Delay
+	if c.Jitter > 0 {
+		delay += time.Duration(f.rand.Int63n(int64(c.Jitter)))
+	}
+	if f.rand.Float64() < c.Reorder {
+		if c.ReorderDelay == 0 {
+			c.ReorderDelay = DefaultReorderDelay
+		}
+		delay += c.ReorderDelay
+	}
+	f.mu.Unlock()
+
+	for i := 0; i < copies; i++ {
+		if delay == 0 {
+			deliver(packet)
+			continue
+		}
+		time.AfterFunc(delay, func() { deliver(packet) })
+	}
+}
@@ -0,0 +1,269 @@
+package lossy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// the number of packets queued for a socket before more are dropped
+const queueSize = 256
+
+// Network is an in-memory UDP network, where every packet sent goes through
+// the faults of its Config. it doesn't touch the kernel, so tests using it
+// are independent of the machine's sockets and timing of the loopback
+type Network struct {
+	faults *faults
+
+	mu       sync.Mutex
+	sockets  map[string]*socket
+	nextPort int
+}
+
+// NewNetwork returns an empty network injecting the faults described by config
+func NewNetwork(config Config) *Network {
+	return &Network{
+		faults:   newFaults(config),
+		sockets:  make(map[string]*socket),
+		nextPort: 49152,
+	}
+}
+
+// SetConfig changes the faults injected from now on, such as
+// cutting the network off halfway through a test with a Loss of 1
+func (n *Network) SetConfig(config Config) {
+	n.faults.set(config)
+}
+
+// ListenPacket binds a socket to address on the network, with the same
+// signature as net.ListenPacket. network must be udp, udp4 or udp6.
+// the port is picked if 0, and an unspecified address is the loopback
+func (n *Network) ListenPacket(network, address string) (net.PacketConn, error) {
+	switch network {
+	case "udp", "udp4", "udp6":
+	default:
+		return nil, fmt.Errorf("listen %s: unsupported network", network)
+	}
+	addr, err := resolve(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if addr.Port == 0 {
+		for n.sockets[addr.String()] != nil || addr.Port == 0 {
+			addr.Port, n.nextPort = n.nextPort, n.nextPort+1
+		}
+	}
+	if n.sockets[addr.String()] != nil {
+		return nil, fmt.Errorf("listen %s %s: address already in use", network, addr)
+	}
+
+	s := &socket{
+		network: n,
+		addr:    addr,
+		queue:   make(chan packet, queueSize),
+		closed:  make(chan struct{}),
+		read:    newDeadline(),
+	}
+	n.sockets[addr.String()] = s
+	return s, nil
+}
+
+// >> the address a socket is bound to
+// with the loopback in place of an unspecified address
+func resolve(network, address string) (*net.UDPAddr, error) {
+	addr, err := net.ResolveUDPAddr(network, address)
+	if err != nil {
+		return nil, err
+	}
+	if addr.IP == nil || addr.IP.IsUnspecified() {
+		addr.IP = net.IPv4(127, 0, 0, 1)
+		if network == "udp6" {
+			addr.IP = net.IPv6loopback
+		}
+	}
+	if ip4 := addr.IP.To4(); ip4 != nil {
+		addr.IP = ip4
+	}
+	return addr, nil
+}
+
+// >> hands a packet to the socket bound to addr
+// packets to nowhere, or to a full queue, are dropped like UDP would
+func (n *Network) deliver(p packet, to string) {
+	n.mu.Lock()
+	s := n.sockets[to]
+	n.mu.Unlock()
+	if s == nil {
+		return
+	}
+	select {
+	case <-s.closed:
+	case s.queue <- p:
+	default:
+	}
+}
+
+type packet struct {
+	data []byte
+	from net.Addr
+}
+
+// >> a socket bound on a Network
+type socket struct {
+	network *Network
+	addr    *net.UDPAddr
+	queue   chan packet
+
+	closeOnce sync.Once
+	closed    chan struct{}
+	read      *deadline
+	write     time.Time // only checked when writing, writes never block
+	mu        sync.Mutex
+}
+
+func (s *socket) ReadFrom(p []byte) (int, net.Addr, error) {
+	select { // > a closed socket or an expired deadline win over queued packets
+	case <-s.closed:
+		return 0, nil, s.opError("read", net.ErrClosed)
+	case <-s.read.wait():
+		return 0, nil, s.opError("read", os.ErrDeadlineExceeded)
+	default:
+	}
+
+	select {
+	case <-s.closed:
+		return 0, nil, s.opError("read", net.ErrClosed)
+	case <-s.read.wait():
+		return 0, nil, s.opError("read", os.ErrDeadlineExceeded)
+	case pkt := <-s.queue:
+		return copy(p, pkt.data), pkt.from, nil
+	}
+}
+
+func (s *socket) WriteTo(p []byte, addr net.Addr) (int, error) {
+	select {
+	case <-s.closed:
+		return 0, s.opError("write", net.ErrClosed)
+	default:
+	}
+	s.mu.Lock()
+	write := s.write
+	s.mu.Unlock()
+	if !write.IsZero() && !time.Now().Before(write) {
+		return 0, s.opError("write", os.ErrDeadlineExceeded)
+	}
+
+	udpAddr, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return 0, s.opError("write", errors.New("not a UDP address"))
+	}
+	to, err := resolve("udp", udpAddr.String())
+	if err != nil {
+		return 0, s.opError("write", err)
+	}
+
+	from := *s.addr
+	s.network.faults.apply(p, func(data []byte) {
+		s.network.deliver(packet{data: data, from: &from}, to.String())
+	})
+	return len(p), nil
+}
+
+func (s *socket) Close() error {
+	err := s.opError("close", net.ErrClosed)
+	s.closeOnce.Do(func() {
+		close(s.closed)
+		s.network.mu.Lock()
+		delete(s.network.sockets, s.addr.String())
+		s.network.mu.Unlock()
+		err = nil
+	})
+	return err
+}
+
+func (s *socket) LocalAddr() net.Addr { return s.addr }
+
+func (s *socket) SetDeadline(t time.Time) error {
+	_ = s.SetReadDeadline(t)
+	return s.SetWriteDeadline(t)
+}
+
+func (s *socket) SetReadDeadline(t time.Time) error {
+	s.read.set(t)
+	return nil
+}
+
+func (s *socket) SetWriteDeadline(t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.write = t
+	return nil
+}
+
+func (s *socket) opError(op string, err error) error {
+	return &net.OpError{Op: op, Net: "udp", Addr: s.addr, Err: err}
+}
+
+// >> a deadline that wakes up the readers waiting on it
+// the same approach as the pipes of the net package: the channel is
+// closed once the deadline passes, and replaced when it's moved
+type deadline struct {
+	mu     sync.Mutex
+	timer  *time.Timer
+	cancel chan struct{}
+}
+
+func newDeadline() *deadline {
+	return &deadline{cancel: make(chan struct{})}
+}
+
+func (d *deadline) set(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.timer != nil && !d.timer.Stop() {
+		<-d.cancel // > the timer fired, and is closing the channel
+	}
+	d.timer = nil
+
+	closed := isClosed(d.cancel)
+	if t.IsZero() {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		return
+	}
+
+	if wait := time.Until(t); wait > 0 {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		cancel := d.cancel
+		d.timer = time.AfterFunc(wait, func() { close(cancel) })
+		return
+	}
+	if !closed {
+		close(d.cancel)
+	}
+}
+
+func (d *deadline) wait() chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.cancel
+}
+
+func isClosed(c chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,178 @@
+package lossy
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+// >> sends count numbered packets from a to b, and returns what b received
+func exchange(t *testing.T, a, b net.PacketConn, count int) [][]byte {
+	t.Helper()
+	for i := 0; i < count; i++ {
+		if _, err := a.WriteTo([]byte{byte(i)}, b.LocalAddr()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var received [][]byte
+	buf := make([]byte, 16)
+	for {
+		_ = b.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		n, addr, err := b.ReadFrom(buf)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return received
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if addr.String() != a.LocalAddr().String() {
+			t.Fatalf("received packet from %q instead of %q", addr, a.LocalAddr())
+		}
+		received = append(received, append([]byte(nil), buf[:n]...))
+	}
+}
+
+func pair(t *testing.T, n *Network) (net.PacketConn, net.PacketConn) {
+	t.Helper()
+	a, err := n.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := n.ListenPacket("udp", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = a.Close()
+		_ = b.Close()
+	})
+	return a, b
+}
+
+func TestNetwork(t *testing.T) {
+	a, b := pair(t, NewNetwork(Config{}))
+	received := exchange(t, a, b, 10)
+	if len(received) != 10 {
+		t.Fatalf("received %d packets of 10", len(received))
+	}
+	for i, p := range received {
+		if !bytes.Equal(p, []byte{byte(i)}) {
+			t.Fatalf("packet %d is %v", i, p)
+		}
+	}
+
+	// >> closing wakes up a blocked read
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = b.Close()
+	}()
+	_ = b.SetReadDeadline(time.Time{})
+	if _, _, err := b.ReadFrom(make([]byte, 1)); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("expected net.ErrClosed; actual %v", err)
+	}
+	if _, err := a.WriteTo([]byte("lost"), b.LocalAddr()); err != nil {
+		t.Fatalf("writing to a closed address: %v", err)
+	}
+}
+
+func TestNetworkFaults(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		check  func(t *testing.T, received [][]byte)
+	}{
+		{"loss", Config{Seed: 1, Loss: 0.5}, func(t *testing.T, received [][]byte) {
+			if len(received) == 0 || len(received) >= 100 {
+				t.Fatalf("received %d packets of 100", len(received))
+			}
+		}},
+		{"duplicate", Config{Seed: 1, Duplicate: 1}, func(t *testing.T, received [][]byte) {
+			if len(received) != 200 {
+				t.Fatalf("received %d packets instead of 200", len(received))
+			}
+		}},
+		{"corrupt", Config{Seed: 1, Corrupt: 1}, func(t *testing.T, received [][]byte) {
+			for i, p := range received {
+				if p[0] == byte(i) {
+					t.Fatalf("packet %d wasn't corrupted", i)
+				}
+			}
+		}},
+		{"reorder", Config{Seed: 1, Reorder: 0.2}, func(t *testing.T, received [][]byte) {
+			if len(received) != 100 {
+				t.Fatalf("received %d packets of 100", len(received))
+			}
+			for i, p := range received {
+				if p[0] != byte(i) {
+					return
+				}
+			}
+			t.Fatal("packets arrived in order")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := pair(t, NewNetwork(tt.config))
+			tt.check(t, exchange(t, a, b, 100))
+		})
+	}
+}
+
+func TestNetworkSeed(t *testing.T) {
+	// >> the same seed drops the same packets
+	config := Config{Seed: 42, Loss: 0.3, Corrupt: 0.1}
+	a, b := pair(t, NewNetwork(config))
+	first := exchange(t, a, b, 100)
+	c, d := pair(t, NewNetwork(config))
+	second := exchange(t, c, d, 100)
+
+	if len(first) != len(second) {
+		t.Fatalf("received %d packets, then %d", len(first), len(second))
+	}
+	for i := range first {
+		if !bytes.Equal(first[i], second[i]) {
+			t.Fatalf("packet %d differs: %v, then %v", i, first[i], second[i])
+		}
+	}
+}
+
+func TestNetworkDelay(t *testing.T) {
+	a, b := pair(t, NewNetwork(Config{Delay: 100 * time.Millisecond}))
+	start := time.Now()
+	if _, err := a.WriteTo([]byte("ping"), b.LocalAddr()); err != nil {
+		t.Fatal(err)
+	}
+	_ = b.SetReadDeadline(time.Now().Add(time.Second))
+	if _, _, err := b.ReadFrom(make([]byte, 4)); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 100*time.Millisecond {
+		t.Fatalf("packet arrived after %s", d)
+	}
+}
+
+func TestWrap(t *testing.T) {
+	client, err := net.ListenPacket("udp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Close() }()
+	server, err := net.ListenPacket("udp", "127.0.0.1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = server.Close() }()
+
+	received := exchange(t, Wrap(client, Config{Seed: 1, Loss: 1}), server, 10)
+	if len(received) != 0 {
+		t.Fatalf("received %d packets through a broken network", len(received))
+	}
+	received = exchange(t, Wrap(client, Config{Seed: 1, Duplicate: 1}), server, 10)
+	if len(received) != 20 {
+		t.Fatalf("received %d packets instead of 20", len(received))
+	}
+}
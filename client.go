@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"path"
+	"syscall"
+
+	tftp "main/TFTP"
+)
+
+func bindClient(fs *flag.FlagSet, cfg *config) {
+	c := &cfg.Client
+	fs.IntVar(&c.Retries, "retries", c.Retries, "the number of times to resend a packet (10 if 0)")
+	fs.DurationVar(&c.Timeout, "timeout", c.Timeout, "the time to wait for a reply before resending (6s if 0)")
+	fs.StringVar(&c.Mode, "mode", c.Mode, "the transfer mode, octet or netascii")
+	fs.IntVar(&c.BlockSize, "blksize", c.BlockSize, "the block size to ask for (512 if 0)")
+	fs.IntVar(&c.WindowSize, "windowsize", c.WindowSize, "the number of blocks per ack to ask for (1 if 0)")
+	fs.IntVar(&c.Rollover, "rollover", c.Rollover, "the block number that follows 65535, 0 or 1")
+}
+
+func bindGet(fs *flag.FlagSet, cfg *config) {
+	bindClient(fs, cfg)
+	c := &cfg.Client
+	fs.BoolVar(&c.Verify, "verify", c.Verify, "fail unless the server has a .sha256 file to verify the download against")
+	fs.IntVar(&c.Attempts, "attempts", c.Attempts, "the number of times to try the download (3 if 0)")
+	fs.BoolVar(&c.NoSize, "no-tsize", c.NoSize, "don't check the download against the size the server announces")
+}
+
+// >> parses a client command's flags & arguments
+// there are two or three arguments: the server, and the source
+// and destination files, the destination defaulting to the source's name
+func clientArgs(name string, args []string, bind func(*flag.FlagSet, *config)) (clientConfig, [3]string, error) {
+	cfg, args, err := parseConfig(name, args, bind)
+	if err != nil {
+		return clientConfig{}, [3]string{}, err
+	}
+	if len(args) < 2 || len(args) > 3 {
+		return clientConfig{}, [3]string{}, fmt.Errorf("%s: expected a server, a source file and optionally a destination", name)
+	}
+	c := cfg.Client
+	if err := invalid(c.validate()); err != nil {
+		return clientConfig{}, [3]string{}, err
+	}
+
+	files := [3]string{serverAddr(args[0]), args[1], path.Base(args[1])}
+	if len(args) == 3 {
+		files[2] = args[2]
+	}
+	return c, files, nil
+}
+
+func (c clientConfig) client() tftp.Client {
+	return tftp.Client{
+		Retries:    uint8(c.Retries),
+		Timeout:    c.Timeout,
+		Mode:       c.Mode,
+		BlockSize:  c.BlockSize,
+		WindowSize: c.WindowSize,
+		Rollover:   uint16(c.Rollover),
+	}
+}
+
+// >> the server's address, on the TFTP port if none is given
+func serverAddr(addr string) string {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return net.JoinHostPort(addr, "69")
+	}
+	return addr
+}
+
+// >> downloads a file, to stdout if the destination is -
+// files are checked against their size, unless skipped, and any checksum
+// the server has, and only replace the destination once complete
+func get(args []string) error {
+	cfg, files, err := clientArgs("get", args, bindGet)
+	if err != nil {
+		return err
+	}
+	c := cfg.client()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if files[2] != "-" {
+		return c.Download(ctx, files[0], files[1], files[2], tftp.DownloadOptions{
+			RequireChecksum:  cfg.Verify,
+			Attempts:         cfg.Attempts,
+			SkipTransferSize: cfg.NoSize,
+		})
+	}
+	c.TransferSize = !cfg.NoSize
+	r, err := c.Get(ctx, files[0], files[1])
+	if err != nil {
+		return err
+	}
+	defer func() { _ = r.Close() }()
+	_, err = io.Copy(os.Stdout, r)
+	return err
+}
+
+// >> uploads a file, from stdin if the source is -
+func put(args []string) error {
+	cfg, files, err := clientArgs("put", args, bindClient)
+	if err != nil {
+		return err
+	}
+	c := cfg.client()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var r io.Reader = os.Stdin
+	if files[1] != "-" {
+		f, err := os.Open(files[1])
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		r = f
+	} else if files[2] == "-" {
+		return errors.New("put: a remote name is needed when uploading stdin")
+	}
+	return c.Put(ctx, files[0], files[2], r)
+}
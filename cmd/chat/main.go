@@ -0,0 +1,42 @@
+// chat is a terminal client for the TCP chat server, or the server itself.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"main/TCP/chat"
+)
+
+func main() {
+	serve := flag.Bool("serve", false, "run the server, instead of a client")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), `usage: %s [-serve] [address]
+
+the address is the server's, 127.0.0.1:11072 by default. as a client, each
+line typed is said to the current room, unless it's a command, such as
+:JOIN, <room> to join a room by number or name. :HELP lists them all
+`, os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	address := "127.0.0.1"
+	switch flag.NArg() {
+	case 0:
+	case 1:
+		address = flag.Arg(0)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if *serve {
+		log.Fatal(chat.ListenAndServe(address))
+	}
+	if err := chat.RunClient(address, os.Stdin, os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	tftp "main/TFTP"
+
+	"gopkg.in/yaml.v3"
+)
+
+// >> returned for bad flags, once the flag set printed why
+var errUsage = errors.New("usage")
+
+// >> the settings of every command
+// from the defaults, then the --config file, then the flags given
+type config struct {
+	Server serverConfig `yaml:"server"`
+	Client clientConfig `yaml:"client"`
+}
+
+type serverConfig struct {
+	Address       string        `yaml:"address"` // comma separated
+	Root          string        `yaml:"root"`
+	Uploads       string        `yaml:"uploads"`
+	Inventory     string        `yaml:"inventory"`
+	Retries       int           `yaml:"retries"`
+	Timeout       time.Duration `yaml:"timeout"`
+	MaxBlockSize  int           `yaml:"max_block_size"`
+	MaxWindowSize int           `yaml:"max_window_size"`
+	Rollover      int           `yaml:"rollover"`
+	Allow         networks      `yaml:"allow"`
+	Deny          networks      `yaml:"deny"`
+	MaxTransfers  int           `yaml:"max_transfers"`
+	MaxPerClient  int           `yaml:"max_per_client"`
+	Grace         time.Duration `yaml:"grace"`
+	Metrics       string        `yaml:"metrics"`
+}
+
+type clientConfig struct {
+	Retries    int           `yaml:"retries"`
+	Timeout    time.Duration `yaml:"timeout"`
+	Mode       string        `yaml:"mode"`
+	BlockSize  int           `yaml:"block_size"`
+	WindowSize int           `yaml:"window_size"`
+	Rollover   int           `yaml:"rollover"`
+	Verify     bool          `yaml:"verify"`   // get only
+	Attempts   int           `yaml:"attempts"` // get only
+	NoSize     bool          `yaml:"no_tsize"` // get only
+}
+
+func defaultConfig() *config {
+	return &config{
+		Server: serverConfig{
+			Address: "127.0.0.1:69",
+			Root:    ".",
+			Grace:   10 * time.Second,
+		},
+		Client: clientConfig{
+			Mode: tftp.ModeOctet,
+		},
+	}
+}
+
+// >> a list of networks, comma separated on the command line
+type networks []string
+
+func (n *networks) String() string { return strings.Join(*n, ",") }
+
+func (n *networks) Set(v string) error {
+	*n = nil
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			*n = append(*n, s)
+		}
+	}
+	return nil
+}
+
+func (n networks) parse() ([]*net.IPNet, error) {
+	return tftp.ParseNetworks(strings.Join(n, ","))
+}
+
+// >> parses a command's flags, along with the --config file
+// bind defines the command's flags on the fields of cfg. the flags given
+// win over the file, so they're parsed once to find the file, and then
+// applied again over it. returns the remaining arguments
+func parseConfig(name string, args []string, bind func(*flag.FlagSet, *config)) (*config, []string, error) {
+	var path string
+	newFlagSet := func(cfg *config) *flag.FlagSet {
+		fs := flag.NewFlagSet(name, flag.ContinueOnError)
+		fs.StringVar(&path, "config", "", "a YAML or JSON file of settings, overridden by the flags given")
+		bind(fs, cfg)
+		return fs
+	}
+
+	cfg := defaultConfig()
+	fs := newFlagSet(cfg)
+	if err := fs.Parse(args); err != nil {
+		if err != flag.ErrHelp {
+			err = errUsage // > the flag set reported it, along with its usage
+		}
+		return nil, nil, err
+	}
+	if path == "" {
+		return cfg, fs.Args(), nil
+	}
+
+	fileCfg := defaultConfig()
+	if err := loadConfig(path, fileCfg); err != nil {
+		return nil, nil, err
+	}
+	fileFS := newFlagSet(fileCfg)
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		if err == nil {
+			err = fileFS.Set(f.Name, f.Value.String())
+		}
+	})
+	return fileCfg, fs.Args(), err
+}
+
+// >> reads a config file over cfg
+// JSON is YAML, so either works. unknown settings are errors, so that
+// typos don't go unnoticed
+func loadConfig(path string, cfg *config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && err != io.EOF {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// >> every problem with the server's settings
+// reported together, before anything is bound
+func (c serverConfig) validate() []error {
+	var errs []error
+	check := func(ok bool, format string, v ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, v...))
+		}
+	}
+
+	for _, addr := range strings.Split(c.Address, ",") {
+		if _, err := net.ResolveUDPAddr("udp", addr); err != nil {
+			errs = append(errs, fmt.Errorf("address: %w", err))
+		}
+	}
+	if info, err := os.Stat(c.Root); err != nil {
+		errs = append(errs, fmt.Errorf("root: %w", err))
+	} else {
+		check(info.IsDir(), "root: %s is not a directory", c.Root)
+	}
+	if c.Uploads != "" {
+		if info, err := os.Stat(c.Uploads); err != nil {
+			errs = append(errs, fmt.Errorf("uploads: %w", err))
+		} else {
+			check(info.IsDir(), "uploads: %s is not a directory", c.Uploads)
+		}
+	}
+	if c.Inventory != "" {
+		if _, err := tftp.LoadInventory(c.Inventory); err != nil {
+			errs = append(errs, fmt.Errorf("inventory: %w", err))
+		}
+	}
+	check(c.Retries >= 0 && c.Retries <= 255, "retries: %d is not between 0 and 255", c.Retries)
+	check(c.Timeout >= 0, "timeout: %s is negative", c.Timeout)
+	check(c.MaxBlockSize == 0 || (c.MaxBlockSize >= tftp.MinBlockSize && c.MaxBlockSize <= tftp.MaxBlockSize),
+		"max block size: %d is not between %d and %d", c.MaxBlockSize, tftp.MinBlockSize, tftp.MaxBlockSize)
+	check(c.MaxWindowSize >= 0 && c.MaxWindowSize <= tftp.MaxWindowSize,
+		"max window size: %d is not between 1 and %d", c.MaxWindowSize, tftp.MaxWindowSize)
+	check(c.Rollover == 0 || c.Rollover == 1, "rollover: %d is not 0 or 1", c.Rollover)
+	if _, err := c.Allow.parse(); err != nil {
+		errs = append(errs, fmt.Errorf("allow: %w", err))
+	}
+	if _, err := c.Deny.parse(); err != nil {
+		errs = append(errs, fmt.Errorf("deny: %w", err))
+	}
+	check(c.MaxTransfers >= 0, "max transfers: %d is negative", c.MaxTransfers)
+	check(c.MaxPerClient >= 0, "max per client: %d is negative", c.MaxPerClient)
+	check(c.Grace >= 0, "grace: %s is negative", c.Grace)
+	if c.Metrics != "" {
+		if _, _, err := net.SplitHostPort(c.Metrics); err != nil {
+			errs = append(errs, fmt.Errorf("metrics: %w", err))
+		}
+	}
+	return errs
+}
+
+func (c clientConfig) validate() []error {
+	var errs []error
+	check := func(ok bool, format string, v ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, v...))
+		}
+	}
+
+	check(c.Retries >= 0 && c.Retries <= 255, "retries: %d is not between 0 and 255", c.Retries)
+	check(c.Timeout >= 0, "timeout: %s is negative", c.Timeout)
+	check(c.Mode == tftp.ModeOctet || c.Mode == tftp.ModeNetASCII, "mode: %q is not %s or %s",
+		c.Mode, tftp.ModeOctet, tftp.ModeNetASCII)
+	check(c.BlockSize == 0 || (c.BlockSize >= tftp.MinBlockSize && c.BlockSize <= tftp.MaxBlockSize),
+		"block size: %d is not between %d and %d", c.BlockSize, tftp.MinBlockSize, tftp.MaxBlockSize)
+	check(c.WindowSize >= 0 && c.WindowSize <= tftp.MaxWindowSize,
+		"window size: %d is not between 1 and %d", c.WindowSize, tftp.MaxWindowSize)
+	check(c.Rollover == 0 || c.Rollover == 1, "rollover: %d is not 0 or 1", c.Rollover)
+	check(c.Attempts >= 0, "attempts: %d is negative", c.Attempts)
+	return errs
+}
+
+// >> joins the problems found by validate into a single error
+func invalid(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	msg := "invalid configuration:"
+	for _, err := range errs {
+		msg += "\n  " + err.Error()
+	}
+	return errors.New(msg)
+}
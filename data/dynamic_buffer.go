@@ -77,7 +77,8 @@ func (m *Binary) ReadFrom(r io.Reader) (int64, error) {
 		return n, ErrMaxPayloadSize
 	}
 	*m = make([]byte, size)
-	o, err := r.Read(*m) // payload
+	// > a single Read can return less than asked for, such as from a TCP stream
+	o, err := io.ReadFull(r, *m) // payload
 	return n + int64(o), err
 }
 
@@ -125,7 +126,7 @@ func (m *String) ReadFrom(r io.Reader) (int64, error) {
 		return n, ErrMaxPayloadSize
 	}
 	buf := make([]byte, size)
-	o, err := r.Read(buf) // payload
+	o, err := io.ReadFull(r, buf) // payload
 	if err != nil {
 		return n, err
 	}
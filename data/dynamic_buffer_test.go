@@ -1,9 +1,12 @@
 package data
 
 import (
+	"bytes"
+	"io"
 	"net"
 	"reflect"
 	"testing"
+	"testing/iotest"
 )
 
 func TestPayloads(t *testing.T) {
@@ -55,3 +58,34 @@ func TestPayloads(t *testing.T) {
 		t.Logf("[%T] %[1]q", actual)
 	}
 }
+
+// >> payloads arriving a byte at a time, as a stream can deliver them
+func TestPayloadsShortReads(t *testing.T) {
+	b := Binary("Clear is better than clever.")
+	s := String("Errors are values.")
+	var buf bytes.Buffer
+	for _, p := range []Payload{&b, &s} {
+		if _, err := p.WriteTo(&buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := iotest.OneByteReader(&buf)
+	var actualB Binary
+	if _, err := actualB.ReadFrom(r); err != nil {
+		t.Fatal(err)
+	}
+	var actualS String
+	if _, err := actualS.ReadFrom(r); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(b, actualB) || s != actualS {
+		t.Errorf("value mismatch: %q, %q", actualB, actualS)
+	}
+
+	// >> & truncated ones are errors
+	truncated := bytes.NewReader([]byte{BinaryType, 0, 0, 0, 4, 'a'})
+	if _, err := actualB.ReadFrom(truncated); err != io.ErrUnexpectedEOF {
+		t.Errorf("expected %v, got %v", io.ErrUnexpectedEOF, err)
+	}
+}
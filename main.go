@@ -1,24 +1,58 @@
 package main
 
 import (
+	"errors"
 	"flag"
-	"io/ioutil"
-	"log"
-	tftp "main/TFTP"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 )
 
-var (
-	address = flag.String("a", "127.0.0.1:69", "listen address")
-	payload = flag.String("p", "testing.jpg", "file to serve to clients")
-)
+// >> the subcommands, serve being the default
+var commands = map[string]func(args []string) error{
+	"serve": serve,
+	"get":   get,
+	"put":   put,
+}
+
+func usage() {
+	name := filepath.Base(os.Args[0])
+	fmt.Fprintf(os.Stderr, `usage: %[1]s <command> [flags] [arguments]
+
+commands:
+  serve                              serve files over TFTP, the default
+  get [flags] server file [local]    download a file, to stdout if local is -
+  put [flags] server file [remote]   upload a file, from stdin if file is -
+
+every command takes a --config YAML or JSON file, with "server" and
+"client" sections. run "%[1]s <command> -h" for a command's flags
+`, name)
+}
 
 func main() {
-	flag.Parse()
-	p, err := ioutil.ReadFile(*payload)
-	if err != nil {
-		log.Fatal(err)
+	args := os.Args[1:]
+	command := "serve"
+	if len(args) > 0 && (!strings.HasPrefix(args[0], "-") || args[0] == "-h" || args[0] == "--help") {
+		command, args = args[0], args[1:]
 	}
 
-	s := tftp.Server{Payload: p}
-	log.Fatal(s.ListenAndServe(*address))
+	if command == "help" || command == "-h" || command == "--help" {
+		usage()
+		return
+	}
+	run, ok := commands[command]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+	err := run(args)
+	switch {
+	case err == nil:
+	case errors.Is(err, flag.ErrHelp), errors.Is(err, errUsage):
+		os.Exit(2)
+	default:
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	tftp "main/TFTP"
+)
+
+func bindServer(fs *flag.FlagSet, cfg *config) {
+	c := &cfg.Server
+	for _, name := range []string{"address", "a"} {
+		fs.StringVar(&c.Address, name, c.Address, "comma separated listen addresses, such as 0.0.0.0:69,[::]:69")
+	}
+	for _, name := range []string{"root", "p"} {
+		fs.StringVar(&c.Root, name, c.Root, "directory to serve files from")
+	}
+	for _, name := range []string{"uploads", "u"} {
+		fs.StringVar(&c.Uploads, name, c.Uploads, "directory to store uploads in (uploads disabled if empty)")
+	}
+	fs.StringVar(&c.Inventory, "inventory", c.Inventory, "a YAML host inventory of templated files to generate, such as pxelinux.cfg/01-<mac>")
+	fs.IntVar(&c.Retries, "retries", c.Retries, "the number of times to resend a packet (10 if 0)")
+	fs.DurationVar(&c.Timeout, "timeout", c.Timeout, "the time to wait for a reply before resending (6s if 0)")
+	fs.IntVar(&c.MaxBlockSize, "max-blksize", c.MaxBlockSize, "the largest block size clients can negotiate (65464 if 0)")
+	fs.IntVar(&c.MaxWindowSize, "max-windowsize", c.MaxWindowSize, "the largest window clients can negotiate (16 if 0)")
+	fs.IntVar(&c.Rollover, "rollover", c.Rollover, "the block number that follows 65535, 0 or 1")
+	fs.Var(&c.Allow, "allow", "comma separated networks allowed to connect, such as 10.0.0.0/8 (everyone if empty)")
+	fs.Var(&c.Deny, "deny", "comma separated networks refused, even if allowed")
+	fs.IntVar(&c.MaxTransfers, "max", c.MaxTransfers, "the most transfers in progress at once (unlimited if 0)")
+	fs.IntVar(&c.MaxPerClient, "max-client", c.MaxPerClient, "the most transfers in progress per client address (unlimited if 0)")
+	for _, name := range []string{"grace", "g"} {
+		fs.DurationVar(&c.Grace, name, c.Grace, "time given to transfers to complete on shutdown")
+	}
+	for _, name := range []string{"metrics", "m"} {
+		fs.StringVar(&c.Metrics, name, c.Metrics, "address to serve Prometheus metrics on at /metrics (disabled if empty)")
+	}
+}
+
+// >> serves files until interrupted
+func serve(args []string) error {
+	cfg, args, err := parseConfig("serve", args, bindServer)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return fmt.Errorf("serve: unexpected arguments %q", args)
+	}
+	c := cfg.Server
+	if err := invalid(c.validate()); err != nil {
+		return err
+	}
+
+	s := &tftp.Server{
+		Root:          tftp.Dir(c.Root),
+		Retries:       uint8(c.Retries),
+		Timeout:       c.Timeout,
+		MaxBlockSize:  c.MaxBlockSize,
+		MaxWindowSize: c.MaxWindowSize,
+		Rollover:      uint16(c.Rollover),
+		MaxTransfers:  c.MaxTransfers,
+		MaxPerClient:  c.MaxPerClient,
+	}
+	s.Allow, _ = c.Allow.parse() // > validated above
+	s.Deny, _ = c.Deny.parse()
+	if c.Uploads != "" {
+		s.Uploads = tftp.DirSink(c.Uploads)
+	}
+	if c.Inventory != "" {
+		if s.Provider, err = tftp.LoadInventory(c.Inventory); err != nil {
+			return err
+		}
+	}
+	if c.Metrics != "" {
+		m := new(tftp.Metrics)
+		s.Observer = m
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", m)
+		go func() { log.Fatal(http.ListenAndServe(c.Metrics, mux)) }()
+	}
+
+	// >> shutting down gracefully on interrupt
+	// serve waits for the transfers in progress before returning
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		ctx, cancel := context.WithTimeout(context.Background(), c.Grace)
+		defer cancel()
+		if err := s.Shutdown(ctx); err != nil {
+			log.Printf("shutdown: %v", err)
+		}
+	}()
+
+	err = s.ListenAndServe(strings.Split(c.Address, ",")...)
+	if err != tftp.ErrServerClosed {
+		return err
+	}
+	<-done
+	return nil
+}